@@ -1,289 +1,1063 @@
 package Search
 
 import (
+	"context"
+	"math"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"DCAI.com/packages/bitboard"
+	"DCAI.com/packages/util"
 	"github.com/notnil/chess"
 )
 
-var nodesVisited int
-var BestMove *chess.Move
+// Threads is the number of goroutines IterativeDeepening searches with. The extra
+// helper threads share the transposition table with the main one (Lazy SMP).
+var Threads = 1
 
-func QuiescenceSearch(alpha, beta int, game *chess.Game, tt *TranspositionTable, depth int, movesPlayed []string, moves []*chess.Move) int {
-	// Calculate the stand-pat score based on your current evaluation function
-	standPatScore := Eval(game.Position().Board(), game, tt, depth, movesPlayed)
+// NullMovePruning lets a node that is still at least beta after passing its turn be
+// cut off. NullMoveVerification confirms such cutoffs at high depth with a reduced
+// search without null moves, guarding against zugzwang.
+var (
+	NullMovePruning      = true
+	NullMoveVerification = false
+)
+
+// The frontier pruning, each of which can be turned off to measure what it is worth.
+// ReverseFutilityPruning cuts off a node whose static evaluation is far enough above
+// beta, FutilityPruning skips quiet moves that cannot bring a node's evaluation up to
+// alpha, Razoring drops a node far enough below alpha straight into the quiescence
+// search, and DeltaPruning skips captures there that cannot bring it up to alpha.
+var (
+	ReverseFutilityPruning = true
+	FutilityPruning        = true
+	Razoring               = true
+	DeltaPruning           = true
+)
+
+// Contempt is how many centipawns worse than DrawScore the engine rates a draw, and so
+// how much it prefers playing on over repeating or trading down into a drawn ending.
+var Contempt = 0
+
+const (
+	// stopCheckInterval is how many nodes a thread searches between polls of the context.
+	stopCheckInterval = 32
+
+	// infinity bounds every score the search can return.
+	infinity = 32000
+
+	// MateScore is the score of giving mate at the root. A mate found ply plies from the
+	// root scores MateScore - ply for the side giving it, so that nearer mates score
+	// higher, and every score at or beyond ±MaxMateScore is a mate.
+	MateScore    = 31000
+	MaxMateScore = MateScore - maxPly
+
+	// DrawScore is the score of a drawn position for either side, before Contempt.
+	DrawScore = 0
+
+	// fiftyMovePlies is the halfmove clock at which the fifty-move rule draws the game.
+	fiftyMovePlies = 100
+
+	// maxPly is the deepest ply the main search goes to, and the size of the PV table.
+	maxPly = 128
+
+	// Iterations from aspirationDepth on search a window of aspirationWindow either side
+	// of the previous score first, doubling it after every fail-high or fail-low.
+	aspirationDepth  = 4
+	aspirationWindow = 25
+
+	// Null moves are tried from nullMoveDepth on and verified from nullVerifyDepth on.
+	nullMoveDepth   = 3
+	nullVerifyDepth = 6
+
+	// A hash move searched to at least singularDepth-3 is extended from singularDepth on
+	// if every other move fails low against its hash score less singularMargin per ply.
+	singularDepth  = 6
+	singularMargin = 2
+
+	// Reverse futility pruning works up to reverseFutilityDepth, with a margin of
+	// reverseFutilityMargin per ply. Futility pruning and razoring work up to the depth
+	// their margins go to.
+	reverseFutilityDepth  = 5
+	reverseFutilityMargin = 100
+
+	// deltaMargin is how much more than the piece it takes a capture in the quiescence
+	// search is allowed for, to cover positional gains.
+	deltaMargin = 200
+
+	// A PV node from iidDepth on that has no hash move gets one from a search
+	// iidReduction plies shallower first (internal iterative deepening).
+	iidDepth     = 4
+	iidReduction = 2
+
+	// Quiet checks are searched in the first quiescenceCheckDepth plies of the
+	// quiescence search, captures in all of them.
+	quiescenceCheckDepth = 1
+
+	// Quiet moves after the first lmrMoves are reduced from lmrDepth on. At non-PV nodes
+	// up to lmpDepth, quiet moves after the first 3+depth*depth are not searched at all.
+	lmrDepth = 3
+	lmrMoves = 3
+	lmpDepth = 3
+
+	// Move ordering scores. Captures and promotions that do not lose material come first
+	// by SEE, then the killers and the countermove, then the remaining quiet moves by
+	// history, and the losing captures last.
+	captureScore       = 10 << 16
+	killerScore        = 7 << 16
+	counterMoveScore   = 5 << 16
+	losingCaptureScore = -captureScore
+
+	// historyMax bounds the history scores, which the gravity update approaches but never passes.
+	historyMax = 16384
+)
+
+// futilityMargins[depth] and razorMargins[depth] are how far below alpha the static
+// evaluation has to be for futility pruning and razoring at depth.
+var (
+	futilityMargins = [...]int{0, 150, 300, 500}
+	razorMargins    = [...]int{0, 300, 500}
+)
+
+// lmrReductions[depth][moveIndex] is how many plies a late quiet move is reduced by.
+var lmrReductions [64][64]int
+
+func init() {
+	for depth := 1; depth < 64; depth++ {
+		for moveIndex := 1; moveIndex < 64; moveIndex++ {
+			lmrReductions[depth][moveIndex] = int(0.75 + math.Log(float64(depth))*math.Log(float64(moveIndex))/2.25)
+		}
+	}
+}
+
+// searchThread holds the state owned by one goroutine of a search.
+type searchThread struct {
+	id    int
+	tt    *TranspositionTable
+	nodes atomic.Int64
+	ctx   context.Context
+
+	// stop is shared by all threads. It is set when the context is done, when the node
+	// budget is spent or once the main thread has finished, telling every thread to
+	// abandon what it is searching.
+	stop *atomic.Bool
+
+	// maxNodes is the node budget of the whole search, 0 for none, and searched counts
+	// the nodes visited so far by all threads together.
+	maxNodes int
+	searched func() int
 
-	// Compare the stand-pat score with beta
-	if standPatScore >= beta {
-		return beta
+	// root is the game the search started from. rootPV is the best move of the previous
+	// iteration and rootPVSearched records whether this iteration has finished searching it.
+	root           *chess.Game
+	rootPV         *chess.Move
+	rootPVSearched bool
+
+	// rootDepth is the depth of the iteration being searched. Extensions stop at twice
+	// that many plies, so that a line of checks cannot make the search explode.
+	rootDepth int
+
+	// pvTable is the triangular PV table: row ply holds the best line found from that
+	// ply on, in pvTable[ply][ply:pvLength[ply]].
+	pvTable  [maxPly][maxPly]*chess.Move
+	pvLength [maxPly]int
+
+	// stack holds what each node needs to know about how it was reached. The parent
+	// fills in stack[ply+1] before searching a child.
+	stack [maxPly + 1]plyState
+
+	// gameKeys are the Zobrist keys of the positions played before the root, oldest
+	// first, and pathKeys[ply] is the key of the node at ply on the current search path,
+	// worked out incrementally by the parent before it searches the node.
+	// Together they are the history repetitions are found in.
+	gameKeys []uint64
+	pathKeys [maxPly + 1]uint64
+
+	// killers are the last two quiet moves that caused a beta cutoff at each ply.
+	killers [maxPly][2]util.PackedMove
+
+	// history scores quiet moves by side, from and to square, by how often they caused
+	// beta cutoffs. countermoves holds the quiet move that last refuted a move, indexed
+	// by the piece that moved and where it went.
+	history      [3][64][64]int
+	countermoves [13][64]util.PackedMove
+}
+
+// plyState describes the node at one ply of the current search path.
+type plyState struct {
+	inCheck   bool // the side to move is in check
+	nullMove  bool // the node was reached by a null move
+	verifying bool // a null-move verification search is running from this node
+
+	previous *chess.Move // the move that led to the node, nil after a null move
+	excluded *chess.Move // the move a singular extension search leaves out
+}
+
+// stopped reports whether the search has to be abandoned.
+func (t *searchThread) stopped() bool {
+	if t.stop.Load() {
+		return true
+	}
+	if t.nodes.Load()%stopCheckInterval == 0 &&
+		(t.ctx.Err() != nil || t.maxNodes > 0 && t.searched() >= t.maxNodes) {
+		t.stop.Store(true)
+		return true
 	}
+	return false
+}
+
+// SearchInfo describes an iteration of IterativeDeepening that has just completed, or
+// an aspiration window it has just failed.
+type SearchInfo struct {
+	Depth    int
+	Score    int
+	Bound    int // ExactScore, or LowerBound/UpperBound when reporting an aspiration fail-high/fail-low
+	Nodes    int
+	Elapsed  time.Duration
+	BestMove *chess.Move
+	PV       []*chess.Move // the line the engine expects, starting with BestMove
+}
 
-	// If the stand-pat score is greater than alpha, update alpha
-	if alpha < standPatScore {
-		alpha = standPatScore
+// evaluate returns bitboard.Eval from the point of view of the side to move. Eval
+// itself scores the position for white.
+func (t *searchThread) evaluate(game *chess.Game) int {
+	score := bitboard.Eval(game.Position().Board())
+	if game.Position().Turn() == chess.Black {
+		return -score
 	}
+	return score
+}
 
-	// Check all moves to see if they are captures or checks
-	ValMoves := game.ValidMoves()
+func (t *searchThread) QuiescenceSearch(alpha, beta int, game *chess.Game, depth, ply int, inCheck bool) int {
+	t.nodes.Add(1)
+	if t.stopped() {
+		return alpha
+	}
 
-	for _, move := range ValMoves {
-		// Check if the move is a capture or check
-		isCapture := move.HasTag(chess.Capture)
-		isCheck := move.HasTag(chess.Check)
+	// A capture or check can end the game, and then there is nothing to evaluate.
+	switch {
+	case game.Method() == chess.Checkmate:
+		return -MateScore + ply
+	case game.Outcome() == chess.Draw:
+		return t.drawScore(ply)
+	}
+	if ply >= maxPly-1 {
+		return t.evaluate(game)
+	}
 
-		// If it's a capture or check, apply the QFilterMoves function to assess its value
-		if isCapture || isCheck {
-			moveValue := QFilterMove(move, game)
+	see := staticExchange(game)
+	var candidates []*chess.Move
 
-			if moveValue == -1 {
-				continue
-			}
+	if inCheck {
+		// There is no standing pat in check: every evasion is searched, and a side with
+		// none is mated, which was scored above.
+		candidates = game.ValidMoves()
+	} else {
+		// Calculate the stand-pat score based on your current evaluation function
+		standPatScore := t.evaluate(game)
 
-			Copy := game.Clone()
-			Copy.Move(move)
-			score := -QuiescenceSearch(-beta, -alpha, Copy, tt, depth-1, movesPlayed, moves)
+		// Compare the stand-pat score with beta
+		if standPatScore >= beta {
+			return beta
+		}
 
-			if score >= beta {
-				return beta
-			}
-			if score > alpha {
-				alpha = score
+		// If the stand-pat score is greater than alpha, update alpha
+		if alpha < standPatScore {
+			alpha = standPatScore
+		}
+
+		// Search the captures, and the checks near the main search, leaving out those
+		// that lose material once the exchange they start is played out.
+		checks := depth > -quiescenceCheckDepth
+		for _, move := range game.ValidMoves() {
+			if (move.HasTag(chess.Capture) || (checks && move.HasTag(chess.Check))) && see(move) >= 0 {
+				// Delta pruning: even winning the piece outright leaves this below alpha.
+				if DeltaPruning && !move.HasTag(chess.Check) && move.Promo() == chess.NoPieceType &&
+					standPatScore+capturedValue(game, move)+deltaMargin <= alpha {
+					continue
+				}
+				candidates = append(candidates, move)
 			}
+		}
+	}
+
+	// Best exchange first.
+	for _, move := range orderByScore(candidates, see) {
+		Copy := game.Clone()
+		Copy.Move(move)
+		score := -t.QuiescenceSearch(-beta, -alpha, Copy, depth-1, ply+1, move.HasTag(chess.Check))
 
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
 		}
 	}
 
 	return alpha
 }
 
-// Function for the alpha-beta search
-func NegaMaxAlphabeta(game *chess.Game, depth, alpha, beta int, MaximisingPlayer bool, tt *TranspositionTable, movesPlayed []string) (int, *chess.Move, int) {
-	nodesVisited++
+// updatePV makes move, followed by the line below it, the best line from ply.
+func (t *searchThread) updatePV(ply int, move *chess.Move) {
+	t.pvTable[ply][ply] = move
+	copy(t.pvTable[ply][ply+1:], t.pvTable[ply+1][ply+1:t.pvLength[ply+1]])
+	t.pvLength[ply] = t.pvLength[ply+1]
+}
+
+// storeKiller remembers a quiet move that caused a beta cutoff at ply.
+func (t *searchThread) storeKiller(ply int, move *chess.Move) {
+	packed := util.EncodeMove(move)
+	if t.killers[ply][0] != packed {
+		t.killers[ply][1] = t.killers[ply][0]
+		t.killers[ply][0] = packed
+	}
+}
 
-	hashKey := HashPosition(game.Position())
-	entry, found := tt.Lookup(hashKey)
+func (t *searchThread) isKiller(ply int, move *chess.Move) bool {
+	packed := util.EncodeMove(move)
+	return t.killers[ply][0] == packed || t.killers[ply][1] == packed
+}
 
-	if found && entry.Depth >= depth {
-		if entry.ScoreType == ExactScore {
-			return entry.Score, entry.BestMove, 1
+// updateHistory rewards the quiet move that caused a beta cutoff and penalises the
+// quiet moves searched before it, by more the deeper the node.
+func (t *searchThread) updateHistory(color chess.Color, best *chess.Move, tried []*chess.Move, depth int) {
+	bonus := min(depth*depth, historyMax/16)
+	t.addHistory(color, best, bonus)
+	for _, move := range tried {
+		t.addHistory(color, move, -bonus)
+	}
+}
+
+// addHistory applies a bonus with gravity: the closer an entry is to historyMax the
+// less it moves, so old successes fade as new ones come in.
+func (t *searchThread) addHistory(color chess.Color, move *chess.Move, bonus int) {
+	entry := &t.history[color][move.S1()][move.S2()]
+	*entry += bonus - *entry*abs(bonus)/historyMax
+}
+
+// counterMove returns the stored refutation of the move that led to the node at ply.
+func (t *searchThread) counterMove(game *chess.Game, ply int) util.PackedMove {
+	previous := t.stack[ply].previous
+	if previous == nil {
+		return 0
+	}
+	piece := game.Position().Board().Piece(previous.S2())
+	return t.countermoves[piece][previous.S2()]
+}
+
+func (t *searchThread) storeCounterMove(game *chess.Game, ply int, move *chess.Move) {
+	previous := t.stack[ply].previous
+	if previous == nil {
+		return
+	}
+	piece := game.Position().Board().Piece(previous.S2())
+	t.countermoves[piece][previous.S2()] = util.EncodeMove(move)
+}
+
+// orderMoves orders captures and promotions by SEE and quiet moves by the killers,
+// countermove and history of this thread. It keeps the moves that draw, which the
+// search scores by the rules itself.
+func (t *searchThread) orderMoves(game *chess.Game, moves []*chess.Move, ply int) []*chess.Move {
+	color := game.Position().Turn()
+	killers := t.killers[ply]
+	counter := t.counterMove(game, ply)
+	see := staticExchange(game)
+
+	return orderByScore(moves, func(move *chess.Move) int {
+		if !isQuiet(move) {
+			value := see(move)
+			if value < 0 {
+				return losingCaptureScore + value
+			}
+			return captureScore + value
+		}
+
+		switch util.EncodeMove(move) {
+		case killers[0]:
+			return killerScore + 1
+		case killers[1]:
+			return killerScore
+		case counter:
+			return counterMoveScore
+		}
+		return t.history[color][move.S1()][move.S2()]
+	})
+}
+
+// drawScore is the score of a draw for the side to move at ply. Contempt makes the side
+// to move at the root rate it below DrawScore, and so its opponent above.
+func (t *searchThread) drawScore(ply int) int {
+	if ply%2 == 0 {
+		return DrawScore - Contempt
+	}
+	return DrawScore + Contempt
+}
+
+// isRepetition reports whether the node at ply repeats an earlier position with the
+// same side to move: once is enough if the earlier one is inside the search, where the
+// side that could have avoided it chose not to, and it takes two before the root, which
+// makes this the third occurrence. Positions before the last capture, pawn move or null
+// move cannot come back, so the search stops there.
+func (t *searchThread) isRepetition(ply, halfmoveClock int) bool {
+	reach := halfmoveClock
+	for p := ply; p > 0 && ply-p < reach; p-- {
+		if t.stack[p].nullMove {
+			reach = ply - p
+			break
+		}
+	}
+
+	key := t.pathKeys[ply]
+	root := len(t.gameKeys)
+	current := root + ply
+	occurrences := 0
+	for back := 4; back <= reach && back <= current; back += 2 {
+		index := current - back
+
+		var earlier uint64
+		if index >= root {
+			earlier = t.pathKeys[index-root]
+		} else {
+			earlier = t.gameKeys[index]
 		}
-		if entry.ScoreType == LowerBound && entry.Score >= beta {
-			return entry.Score, entry.BestMove, 1
+		if earlier != key {
+			continue
+		}
+
+		occurrences++
+		if index > root || occurrences == 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// moveSource returns the moves of game one at a time in the order the search tries
+// them, and nil after the last one. The hash move comes first, on its own: the rest
+// are only ordered once it has been searched without a cutoff.
+func (t *searchThread) moveSource(game *chess.Game, hashMove *chess.Move, ply int) func() *chess.Move {
+	var moves []*chess.Move
+	if hashMove != nil {
+		moves = append(moves, hashMove)
+	}
+	next, ordered := 0, false
+
+	return func() *chess.Move {
+		if next == len(moves) && !ordered {
+			ordered = true
+			for _, move := range t.orderMoves(game, game.ValidMoves(), ply) {
+				if move != hashMove {
+					moves = append(moves, move)
+				}
+			}
 		}
-		if entry.ScoreType == UpperBound && entry.Score <= alpha {
-			return entry.Score, entry.BestMove, 1
+		if next == len(moves) {
+			return nil
 		}
+		next++
+		return moves[next-1]
 	}
+}
 
-	ValMoves := game.ValidMoves()
-	OrderedMoves := OrderMoves(game, ValMoves)
+// principalVariation returns a copy of the line found by the last search from the root.
+func (t *searchThread) principalVariation() []*chess.Move {
+	return append([]*chess.Move(nil), t.pvTable[0][:t.pvLength[0]]...)
+}
 
-	if game.Outcome() != chess.NoOutcome || depth == 0 {
-		return QuiescenceSearch(alpha, beta, game, tt, depth-1, movesPlayed, OrderedMoves), nil, 1
+// NegaMaxAlphabeta searches game to depth and returns the score from the point of view
+// of the side to move, the best move and the number of nodes visited. The first move
+// is searched with the full window; every later one is first scouted with a null window
+// around alpha and only re-searched with the full window if it turns out to be better
+// (principal variation search).
+func (t *searchThread) NegaMaxAlphabeta(game *chess.Game, depth, ply, alpha, beta int) (int, *chess.Move, int) {
+	t.nodes.Add(1)
+	t.pvLength[ply] = ply
+	if t.stopped() {
+		return 0, nil, 1
+	}
+	if ply == 0 {
+		t.rootDepth = depth
+	}
+	state := &t.stack[ply]
+
+	hashKey := t.pathKeys[ply]
+
+	// Mates and draws are scored by the rules rather than by Eval. Only a stalemate or
+	// a mate can end the search at the root, which has to come back with a move.
+	halfmoveClock := game.Position().HalfMoveClock()
+	switch {
+	case game.Method() == chess.Checkmate:
+		return -MateScore + ply, nil, 1
+	case game.Method() == chess.Stalemate:
+		return t.drawScore(ply), nil, 1
+	case ply > 0 && (game.Outcome() == chess.Draw || halfmoveClock >= fiftyMovePlies || t.isRepetition(ply, halfmoveClock)):
+		return t.drawScore(ply), nil, 1
+	}
+
+	// Mate distance pruning: nothing found from here can beat a mate nearer the root.
+	if ply > 0 {
+		alpha = max(alpha, -MateScore+ply)
+		beta = min(beta, MateScore-ply-1)
+		if alpha >= beta {
+			return alpha, nil, 1
+		}
+	}
+
+	entry, found := t.tt.Lookup(hashKey)
+	var hashMove *chess.Move
+	if found {
+		hashMove = entry.BestMove.Decode(game.Position())
+	}
+
+	// The root always searches, so that it comes back with a full PV, and a search
+	// leaving out a move is not the search the entry was stored for.
+	if found && entry.Depth >= depth && ply > 0 && state.excluded == nil {
+		score := scoreFromTT(entry.Score, ply)
+		if entry.ScoreType == ExactScore {
+			return score, hashMove, 1
+		}
+		if entry.ScoreType == LowerBound && score >= beta {
+			return score, hashMove, 1
+		}
+		if entry.ScoreType == UpperBound && score <= alpha {
+			return score, hashMove, 1
+		}
+	}
 
+	if depth <= 0 || ply >= maxPly-1 {
+		return t.QuiescenceSearch(alpha, beta, game, 0, ply, state.inCheck), nil, 1
 	}
 
 	visitedNodes := 1
-	var BestMove *chess.Move
+	pvNode := beta-alpha > 1
+
+	// The static evaluation is only worth its cost for the frontier pruning below, at
+	// non-PV nodes out of check near the leaves.
+	frontier := !pvNode && !state.inCheck && state.excluded == nil && depth <= reverseFutilityDepth
+	staticEval := 0
+	if frontier {
+		staticEval = t.evaluate(game)
+	}
 
-	if MaximisingPlayer {
-		MaxEval := -9999
+	// Reverse futility pruning: a position this far above beta before moving will
+	// almost always stay above it whatever is played.
+	if ReverseFutilityPruning && frontier && abs(beta) < MaxMateScore && staticEval-reverseFutilityMargin*depth >= beta {
+		return staticEval, nil, visitedNodes
+	}
 
-		for _, move := range OrderedMoves {
-			Copy := game.Clone()
-			Copy.Move(move)
-			eval, _, visited := NegaMaxAlphabeta(Copy, depth-1, alpha, beta, false, tt, movesPlayed)
+	// Razoring: a position this far below alpha is unlikely to be rescued by a quiet
+	// move, so only the captures get a chance to bring it back.
+	if Razoring && frontier && depth < len(razorMargins) && staticEval+razorMargins[depth] < alpha {
+		if score := t.QuiescenceSearch(alpha-1, alpha, game, 0, ply, false); score < alpha {
+			return score, nil, visitedNodes
+		}
+	}
 
+	// Null-move pruning: if passing the turn still leaves us at beta or above, a real
+	// move will almost always do so too. Not in check, where passing is illegal, not
+	// twice in a row, not at PV nodes and not with only pawns left, where zugzwang is common.
+	if NullMovePruning && depth >= nullMoveDepth && beta-alpha == 1 && !state.inCheck && !state.nullMove &&
+		!state.verifying && state.excluded == nil && hasNonPawnMaterial(game.Position()) {
+		if nullGame := nullMoveGame(game); nullGame != nil {
+			R := 2 + depth/4
+			t.stack[ply+1] = plyState{nullMove: true}
+			t.pathKeys[ply+1] = HashPosition(nullGame.Position())
+			score, _, visited := t.NegaMaxAlphabeta(nullGame, max(depth-1-R, 0), ply+1, -beta, -beta+1)
+			score = -score
 			visitedNodes += visited
 
-			if eval > MaxEval {
-				MaxEval = eval
-				BestMove = move
+			if t.stop.Load() {
+				return 0, nil, visitedNodes
+			}
+			if score >= beta && NullMoveVerification && depth >= nullVerifyDepth {
+				state.verifying = true
+				score, _, visited = t.NegaMaxAlphabeta(game, depth-R, ply, beta-1, beta)
+				state.verifying = false
+				visitedNodes += visited
 			}
+			// A mate found after passing is not a mate the position really has.
+			if score >= beta {
+				if score >= MaxMateScore {
+					score = beta
+				}
+				return score, nil, visitedNodes
+			}
+		}
+	}
 
-			alpha = max(alpha, eval)
-			if beta <= alpha {
-				break
+	// Internal iterative deepening: a PV node without a hash move would have to rely on
+	// the static ordering alone, so a shallower search finds it a first move to try.
+	// The root is left out: iterative deepening already orders it, and a search of the
+	// root from here would reset rootDepth and rootPVSearched for the iteration.
+	if hashMove == nil && pvNode && ply > 0 && depth >= iidDepth && state.excluded == nil {
+		_, move, visited := t.NegaMaxAlphabeta(game, depth-iidReduction, ply, alpha, beta)
+		t.pvLength[ply] = ply
+		visitedNodes += visited
+
+		if t.stop.Load() {
+			return 0, nil, visitedNodes
+		}
+		hashMove = move
+	}
+
+	// Singular extension: a hash move that is the only move holding up, every other one
+	// failing low against a margin below its hash score, is searched a ply deeper.
+	var singularMove *chess.Move
+	if depth >= singularDepth && ply > 0 && state.excluded == nil && found && hashMove != nil &&
+		entry.ScoreType != UpperBound && entry.Depth >= depth-3 {
+		hashScore := scoreFromTT(entry.Score, ply)
+		if abs(hashScore) < MaxMateScore {
+			singularBeta := hashScore - singularMargin*depth
+			state.excluded = hashMove
+			score, _, visited := t.NegaMaxAlphabeta(game, (depth-1)/2, ply, singularBeta-1, singularBeta)
+			state.excluded = nil
+			t.pvLength[ply] = ply
+			visitedNodes += visited
+
+			if t.stop.Load() {
+				return 0, nil, visitedNodes
+			}
+			if score < singularBeta {
+				singularMove = hashMove
 			}
 		}
+	}
 
-		var scoreType int
-		if MaxEval <= alpha {
-			scoreType = UpperBound
-		} else if MaxEval >= beta {
-			scoreType = LowerBound
-		} else {
-			scoreType = ExactScore
+	nextMove := t.moveSource(game, hashMove, ply)
+
+	originalAlpha := alpha
+	futile := FutilityPruning && frontier && depth < len(futilityMargins) && abs(alpha) < MaxMateScore &&
+		staticEval+futilityMargins[depth] <= alpha
+	BestScore := -infinity
+	var BestMove *chess.Move
+	var quietsTried []*chess.Move
+
+	for i, move := 0, nextMove(); move != nil; i, move = i+1, nextMove() {
+		if move == state.excluded {
+			continue
 		}
 
-		tt.Store(hashKey, TranspositionTableEntry{
-			HashKey:   hashKey,
-			Depth:     depth,
-			Score:     MaxEval,
-			ScoreType: scoreType,
-			BestMove:  BestMove,
-		})
+		// Checks and the singular move are searched a ply deeper, as long as the line
+		// has not already been extended to twice the depth of the iteration.
+		newDepth := depth - 1
+		if (move.HasTag(chess.Check) || move == singularMove) && ply < 2*t.rootDepth {
+			newDepth++
+		}
 
-		return MaxEval, BestMove, visitedNodes
-	} else {
-		MinEval := 9999
+		// Captures, promotions, checks and killers are never reduced or pruned.
+		late := isQuiet(move) && !move.HasTag(chess.Check) && !state.inCheck && !t.isKiller(ply, move)
 
-		for _, move := range OrderedMoves {
-			Copy := game.Clone()
-			Copy.Move(move)
-			eval, _, visited := NegaMaxAlphabeta(Copy, depth-1, alpha, beta, true, tt, movesPlayed)
-			visitedNodes += visited
+		// Late-move pruning: this close to the leaves a quiet move this far down the
+		// ordering is very unlikely to do better than the moves already searched.
+		if late && !pvNode && depth <= lmpDepth && i >= 3+depth*depth && BestMove != nil {
+			continue
+		}
 
-			if eval < MinEval {
-				MinEval = eval
-				BestMove = move
+		// Futility pruning: this close to the leaves a quiet move is not going to make
+		// up the distance between the static evaluation and alpha.
+		if late && futile && BestMove != nil {
+			continue
+		}
+
+		t.pathKeys[ply+1] = util.ZobristUpdate(hashKey, game.Position(), move)
+		Copy := game.Clone()
+		Copy.Move(move)
+		t.stack[ply+1] = plyState{inCheck: move.HasTag(chess.Check), previous: move}
+
+		var score, visited int
+		if i == 0 {
+			score, _, visited = t.NegaMaxAlphabeta(Copy, newDepth, ply+1, -beta, -alpha)
+			score = -score
+		} else {
+			// Late-move reductions: later quiet moves are scouted less deeply, one ply
+			// less so at PV nodes.
+			reduction := 0
+			if late && depth >= lmrDepth && i >= lmrMoves {
+				reduction = lmrReductions[min(depth, 63)][min(i, 63)]
+				if pvNode {
+					reduction--
+				}
+				reduction = min(max(reduction, 0), newDepth-1)
 			}
 
-			beta = min(beta, eval)
-			if beta <= alpha {
-				break
+			score, _, visited = t.NegaMaxAlphabeta(Copy, newDepth-reduction, ply+1, -alpha-1, -alpha)
+			score = -score
+
+			// A reduced move that beats alpha is scouted again at full depth.
+			if reduction > 0 && score > alpha && !t.stop.Load() {
+				var researched int
+				score, _, researched = t.NegaMaxAlphabeta(Copy, newDepth, ply+1, -alpha-1, -alpha)
+				score = -score
+				visited += researched
+			}
+
+			// The scout says the move is better than the best so far, so find out by how much.
+			if score > alpha && score < beta && !t.stop.Load() {
+				var researched int
+				score, _, researched = t.NegaMaxAlphabeta(Copy, newDepth, ply+1, -beta, -alpha)
+				score = -score
+				visited += researched
 			}
 		}
+		visitedNodes += visited
 
-		var scoreType int
-		if MinEval <= alpha {
-			scoreType = UpperBound
-		} else if MinEval >= beta {
-			scoreType = LowerBound
-		} else {
-			scoreType = ExactScore
+		// The reply was cut short, so its score means nothing.
+		if t.stop.Load() {
+			break
+		}
+		if game == t.root && move == t.rootPV {
+			t.rootPVSearched = true
 		}
 
-		tt.Store(hashKey, TranspositionTableEntry{
-			HashKey:   hashKey,
-			Depth:     depth,
-			Score:     MinEval,
-			ScoreType: scoreType,
-			BestMove:  BestMove,
-		})
+		if score > BestScore {
+			BestScore = score
+			// A root move that fails low has only an upper bound, which does not rank
+			// it against the others, so it cannot become the move to play.
+			if ply > 0 || score > alpha {
+				BestMove = move
+			}
+		}
+
+		if score > alpha {
+			alpha = score
+			t.updatePV(ply, move)
+		}
+		if alpha >= beta {
+			if isQuiet(move) {
+				t.storeKiller(ply, move)
+				t.updateHistory(game.Position().Turn(), move, quietsTried, depth)
+				t.storeCounterMove(game, ply, move)
+			}
+			break
+		}
+		if isQuiet(move) {
+			quietsTried = append(quietsTried, move)
+		}
+	}
 
-		return MinEval, BestMove, visitedNodes
+	// A search that was stopped has not looked at every move, so its result must not be
+	// stored, and neither may one that left a move out.
+	if t.stop.Load() {
+		return BestScore, BestMove, visitedNodes
 	}
+	if state.excluded != nil {
+		if BestMove == nil {
+			return alpha, nil, visitedNodes
+		}
+		return BestScore, BestMove, visitedNodes
+	}
+
+	var scoreType int
+	if BestScore <= originalAlpha {
+		scoreType = UpperBound
+	} else if BestScore >= beta {
+		scoreType = LowerBound
+	} else {
+		scoreType = ExactScore
+	}
+
+	t.tt.Store(hashKey, TranspositionTableEntry{
+		HashKey:   hashKey,
+		Depth:     depth,
+		Score:     scoreToTT(BestScore, ply),
+		ScoreType: scoreType,
+		BestMove:  util.EncodeMove(BestMove),
+	})
+
+	return BestScore, BestMove, visitedNodes
 }
 
-func IterativeDeepening(game *chess.Game, maxDepth int, tt *TranspositionTable, movesPlayed []string, timeout time.Duration) (int, *chess.Move, int) {
-	nodesVisited = 0
+// IterativeDeepening searches the position one ply deeper at a time until maxDepth,
+// until ctx is done or until it has visited maxNodes nodes, unless maxNodes is 0. The
+// last two interrupt the search mid-iteration. From aspirationDepth on, each iteration
+// starts with a narrow window around the previous score and widens it whenever the
+// score falls outside. If info is not nil it is called after every
+// completed iteration and after every such fail-high or fail-low, and returning false
+// from it stops the search. The move returned is the one of the last completed
+// iteration, or of the interrupted one if it had already re-searched that move and
+// found one that beats the window, and comes with the principal variation it was
+// found with.
+func IterativeDeepening(ctx context.Context, game *chess.Game, maxDepth, maxNodes int, tt *TranspositionTable, info func(SearchInfo) bool) (int, *chess.Move, int, []*chess.Move) {
+	tt.NewSearch()
 	bestMove := (*chess.Move)(nil)
-	bestScore := -9999
+	bestPV := []*chess.Move(nil)
+	bestScore := -infinity
 	startTime := time.Now()
 
+	// Fill the root position's move cache now, before the threads start reading it.
+	game.ValidMoves()
+
+	var stop atomic.Bool
+	threads := make([]*searchThread, max(Threads, 1))
+	rootInCheck := inCheck(game.Position())
+	gameKeys := gameHistory(game)
+	rootKey := HashPosition(game.Position())
+	nodesVisited := func() int {
+		total := 0
+		for _, thread := range threads {
+			total += int(thread.nodes.Load())
+		}
+		return total
+	}
+	for i := range threads {
+		threads[i] = &searchThread{id: i, tt: tt, ctx: ctx, stop: &stop, maxNodes: maxNodes, searched: nodesVisited,
+			root: game, gameKeys: gameKeys}
+		threads[i].stack[0].inCheck = rootInCheck
+		threads[i].pathKeys[0] = rootKey
+	}
+
+	var helpers sync.WaitGroup
+	for _, helper := range threads[1:] {
+		helpers.Add(1)
+		go func(helper *searchThread) {
+			defer helpers.Done()
+			helper.searchHelper(game, maxDepth)
+		}(helper)
+	}
+
+	report := func(depth, score, bound int) bool {
+		return info == nil || info(SearchInfo{
+			Depth:    depth,
+			Score:    score,
+			Bound:    bound,
+			Nodes:    nodesVisited(),
+			Elapsed:  time.Since(startTime),
+			BestMove: bestMove,
+			PV:       bestPV,
+		})
+	}
+	mainThread := threads[0]
+
+iterations:
 	for depth := 1; depth <= maxDepth; depth++ {
-		elapsedTime := time.Since(startTime)
-		if elapsedTime >= timeout {
+		if ctx.Err() != nil {
 			break
 		}
+		mainThread.rootPV = bestMove
+
+		alpha, beta := -infinity, infinity
+		window := aspirationWindow
+		if depth >= aspirationDepth && bestMove != nil && abs(bestScore) < MaxMateScore {
+			alpha, beta = max(bestScore-window, -infinity), min(bestScore+window, infinity)
+		}
 
 		var score int
 		var move *chess.Move
-		var visited int
 
-		if IsInCheck(game) {
-			score, move, visited = NegaMaxAlphabeta(game, 2, -9999, 9999, true, tt, movesPlayed)
-		} else {
-			score, move, visited = NegaMaxAlphabeta(game, depth, -9999, 9999, true, tt, movesPlayed)
+		for {
+			mainThread.rootPVSearched = false
+			score, move, _ = mainThread.NegaMaxAlphabeta(game, depth, 0, alpha, beta)
+
+			if stop.Load() {
+				break
+			}
+
+			// Widen the window on the side the score fell out of and search again.
+			window *= 2
+			if score <= alpha && alpha > -infinity {
+				if !report(depth, score, UpperBound) {
+					break iterations
+				}
+				beta = (alpha + beta) / 2
+				alpha = max(score-window, -infinity)
+			} else if score >= beta && beta < infinity {
+				if !report(depth, score, LowerBound) {
+					break iterations
+				}
+				beta = min(score+window, infinity)
+			} else {
+				break
+			}
+		}
+
+		if stop.Load() {
+			// An attempt that was stopped before any move beat its alpha has nothing
+			// better to offer than the last completed iteration.
+			if move != nil && score > alpha && (bestMove == nil || mainThread.rootPVSearched) {
+				bestMove = move
+				bestScore = score
+				bestPV = mainThread.principalVariation()
+			}
+			break
 		}
 
-		nodesVisited += visited
+		// A root without moves is mated or stalemated, and score says which.
+		bestScore = score
 		if move != nil {
 			bestMove = move
-			bestScore = score
+			bestPV = mainThread.principalVariation()
 		}
 
-		elapsedTime = time.Since(startTime)
-		if elapsedTime >= timeout {
+		if !report(depth, bestScore, ExactScore) {
 			break
 		}
 	}
 
-	return bestScore, bestMove, nodesVisited
-}
-
-func OrderMoves(game *chess.Game, moves []*chess.Move) []*chess.Move {
-	nonDrawMoves := make([]*chess.Move, 0)
+	stop.Store(true)
+	helpers.Wait()
 
-	for _, move := range moves {
-		Copy := game.Clone()
-		Copy.Move(move)
-
-		if Copy.Outcome() != chess.Draw {
-			nonDrawMoves = append(nonDrawMoves, move)
+	// Never come back empty-handed while there is a legal move.
+	if bestMove == nil {
+		if moves := game.ValidMoves(); len(moves) > 0 {
+			bestMove = moves[0]
 		}
 	}
+	if bestMove != nil && (len(bestPV) == 0 || bestPV[0] != bestMove) {
+		bestPV = []*chess.Move{bestMove}
+	}
 
-	// Now, you can sort the non-draw moves based on your movePriority function
-	sort.SliceStable(nonDrawMoves, func(i, j int) bool {
-		priorityI := movePriority(game, nonDrawMoves[i])
-		priorityJ := movePriority(game, nonDrawMoves[j])
-
-		// Compare moves based on their priority
-		if priorityI != priorityJ {
-			return priorityI > priorityJ
-		}
-		return false
-	})
-
-	return nonDrawMoves
+	return bestScore, bestMove, nodesVisited(), bestPV
 }
 
-func movePriority(game *chess.Game, move *chess.Move) int {
-	if game.Method() == chess.Checkmate {
-		return 4
-	}
-	if move.Promo() != chess.Queen {
-		return 2
+// searchHelper runs a helper thread's own iterative deepening until the main thread
+// finishes. Odd helpers start a ply deeper so that the threads spread over depths and
+// fill the shared transposition table with different parts of the tree.
+func (t *searchThread) searchHelper(game *chess.Game, maxDepth int) {
+	for depth := 1 + t.id%2; depth <= maxDepth && !t.stopped(); depth++ {
+		t.NegaMaxAlphabeta(game, depth, 0, -infinity, infinity)
 	}
-	if move.HasTag(chess.Capture) {
-		return 3
+}
+
+// MateIn returns the number of moves to the mate that score announces, negative when
+// the side to move is the one getting mated, and whether score is a mate score at all.
+func MateIn(score int) (int, bool) {
+	switch {
+	case score >= MaxMateScore:
+		return (MateScore - score + 1) / 2, true
+	case score <= -MaxMateScore:
+		return -(MateScore + score) / 2, true
 	}
-	if move.HasTag(chess.QueenSideCastle) || move.HasTag(chess.KingSideCastle) {
-		return 1
+	return 0, false
+}
+
+// scoreToTT and scoreFromTT convert mate scores between the distance from the root the
+// search works with and the distance from the node the table stores, since the same
+// position can be reached at different plies.
+func scoreToTT(score, ply int) int {
+	switch {
+	case score >= MaxMateScore:
+		return score + ply
+	case score <= -MaxMateScore:
+		return score - ply
 	}
-	srcSquare := move.S1()
-	piece := game.Position().Board().Piece(srcSquare)
-	if piece.Type() == chess.King {
-		return -2
+	return score
+}
+
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score >= MaxMateScore:
+		return score - ply
+	case score <= -MaxMateScore:
+		return score + ply
 	}
+	return score
+}
 
-	Copy := game.Clone()
-	Copy.Move(move)
-	if Copy.Outcome() == chess.Draw {
-		return -1
+// gameHistory returns the Zobrist keys of the positions game went through before its
+// current one, oldest first.
+func gameHistory(game *chess.Game) []uint64 {
+	positions := game.Positions()
+	keys := make([]uint64, 0, len(positions))
+	for _, position := range positions[:max(len(positions)-1, 0)] {
+		keys = append(keys, HashPosition(position))
 	}
-	return 0
+	return keys
 }
 
-func QFilterMove(move *chess.Move, game *chess.Game) int {
-	fromSquare := move.S1()
-	toSquare := move.S2()
+// scoredMove is a move with its ordering score.
+type scoredMove struct {
+	move  *chess.Move
+	score int
+}
 
-	movingPiece := game.Position().Board().Piece(fromSquare)
-	targetPiece := game.Position().Board().Piece(toSquare)
+// orderByScore returns a copy of moves sorted best first, scoring each move only once.
+// The slice passed in may be the position's cached ValidMoves, which other threads read,
+// so it is never reordered.
+func orderByScore(moves []*chess.Move, score func(*chess.Move) int) []*chess.Move {
+	scored := make([]scoredMove, len(moves))
+	for i, move := range moves {
+		scored[i] = scoredMove{move: move, score: score(move)}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
 
-	movingPieceValue := pieceValues[movingPiece.Type()]
-	targetPieceValue := pieceValues[targetPiece.Type()]
+	ordered := make([]*chess.Move, len(scored))
+	for i, s := range scored {
+		ordered[i] = s.move
+	}
+	return ordered
+}
 
-	if movingPieceValue <= targetPieceValue {
-		return 1
+func abs(x int) int {
+	if x < 0 {
+		return -x
 	}
-	return 0
+	return x
+}
 
+// isQuiet reports whether move neither captures nor promotes.
+func isQuiet(move *chess.Move) bool {
+	return !move.HasTag(chess.Capture) && !move.HasTag(chess.EnPassant) && move.Promo() == chess.NoPieceType
 }
 
-func IsInCheck(game *chess.Game) bool {
-	moves := game.Moves()
+// nullMoveGame returns game with the turn passed to the other side. notnil/chess has
+// no null move, so the position is rebuilt from its FEN.
+func nullMoveGame(game *chess.Game) *chess.Game {
+	fields := strings.Fields(game.Position().String())
+	if fields[1] == "w" {
+		fields[1] = "b"
+	} else {
+		fields[1] = "w"
+	}
+	fields[3] = "-"
 
-	if len(moves) == 0 {
-		return false
+	fen, err := chess.FEN(strings.Join(fields, " "))
+	if err != nil {
+		return nil
 	}
+	return chess.NewGame(fen)
+}
 
-	lastMove := moves[len(moves)-1]
+// hasNonPawnMaterial reports whether the side to move has a piece other than pawns and its king.
+func hasNonPawnMaterial(position *chess.Position) bool {
+	board := position.Board()
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		piece := board.Piece(sq)
+		if piece.Color() == position.Turn() && piece.Type() != chess.Pawn && piece.Type() != chess.King {
+			return true
+		}
+	}
+	return false
+}
 
-	return lastMove.HasTag(chess.Check)
+// inCheck reports whether the side to move is in check.
+func inCheck(position *chess.Position) bool {
+	p, err := bitboard.FromChess(position)
+	return err == nil && p.InCheck()
+}
 
+// capturedValue returns the value of the piece move captures, a pawn for en passant.
+func capturedValue(game *chess.Game, move *chess.Move) int {
+	if move.HasTag(chess.EnPassant) {
+		return pieceValues[chess.Pawn]
+	}
+	return pieceValues[game.Position().Board().Piece(move.S2()).Type()]
+}
+
+// staticExchange returns a function giving the SEE of a move of game's position,
+// converting the position to a bitboard.Position only once for all of its moves.
+func staticExchange(game *chess.Game) func(*chess.Move) int {
+	p, err := bitboard.FromChess(game.Position())
+	if err != nil {
+		return func(*chess.Move) int { return 0 }
+	}
+	return func(move *chess.Move) int {
+		return p.SEE(bitboard.ConvertMove(move))
+	}
 }
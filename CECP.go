@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	S "DCAI.com/packages/AI"
+	V "DCAI.com/packages/AI2"
+	"DCAI.com/packages/util"
+	"github.com/notnil/chess"
+)
+
+// defaultMoveTime is used when xboard has sent neither a clock nor "st".
+const defaultMoveTime = time.Second
+
+// thinkFunc runs one engine's IterativeDeepening against its own transposition table
+// and reports each completed iteration through post.
+type thinkFunc func(ctx context.Context, game *chess.Game, maxDepth int, post func(depth, score, nodes int, elapsed time.Duration, pv []*chess.Move) bool) *chess.Move
+
+// CECP drives the AI and AI2 engines over the Chess Engine Communication Protocol (xboard).
+type CECP struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	outMutex sync.Mutex
+
+	// mutex guards the game state, which the search goroutine updates when it moves.
+	mutex       sync.Mutex
+	startFEN    string
+	game        *chess.Game
+	movesPlayed []string
+
+	engines map[string]thinkFunc
+	engine  string
+	clear   []func()
+
+	forceMode   bool
+	engineColor chess.Color
+	post        bool
+
+	maxDepth       int
+	moveTime       time.Duration
+	movesPerPeriod int
+	increment      time.Duration
+	engineClock    time.Duration
+
+	cancel    context.CancelFunc
+	abort     bool
+	searching sync.WaitGroup
+}
+
+func NewCECP(in io.Reader, out io.Writer) *CECP {
+	tt := S.NewTranspositionTable(defaultHashMB)
+	tt2 := V.NewTranspositionTable(defaultHashMB)
+
+	c := &CECP{
+		in:  bufio.NewScanner(in),
+		out: out,
+		engines: map[string]thinkFunc{
+			"AI":  thinkAI(tt),
+			"AI2": thinkAI2(tt2),
+		},
+		engine: "AI",
+		clear: []func(){
+			func() { S.ClearTranspositionTable(tt) },
+			func() { V.ClearTranspositionTable(tt2) },
+		},
+	}
+	c.newGame()
+	return c
+}
+
+func thinkAI(tt *S.TranspositionTable) thinkFunc {
+	return func(ctx context.Context, game *chess.Game, maxDepth int, post func(int, int, int, time.Duration, []*chess.Move) bool) *chess.Move {
+		_, bestMove, _, _ := S.IterativeDeepening(ctx, game, maxDepth, 0, tt, func(info S.SearchInfo) bool {
+			if info.Bound != S.ExactScore {
+				return true
+			}
+			return post(info.Depth, cecpScore(info.Score, S.MateIn), info.Nodes, info.Elapsed, info.PV)
+		})
+		return bestMove
+	}
+}
+
+func thinkAI2(tt *V.TranspositionTable) thinkFunc {
+	return func(ctx context.Context, game *chess.Game, maxDepth int, post func(int, int, int, time.Duration, []*chess.Move) bool) *chess.Move {
+		_, bestMove, _, _ := V.IterativeDeepening(ctx, game, maxDepth, 0, tt, func(info V.SearchInfo) bool {
+			if info.Bound != V.ExactScore {
+				return true
+			}
+			return post(info.Depth, cecpScore(info.Score, V.MateIn), info.Nodes, info.Elapsed, info.PV)
+		})
+		return bestMove
+	}
+}
+
+// Loop reads commands until "quit" or the end of the input.
+func (c *CECP) Loop() {
+	for c.in.Scan() {
+		if !c.Execute(c.in.Text()) {
+			return
+		}
+	}
+	c.stopSearch(true)
+}
+
+// Execute handles a single command line and reports whether the loop should continue.
+func (c *CECP) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+	args := fields[1:]
+
+	switch fields[0] {
+	case "xboard", "accepted", "rejected", "random", "hard", "easy", "computer":
+	case "protover":
+		c.send("feature myname=\"%s\" usermove=1 setboard=1 ping=1 smp=1 sigint=0 sigterm=0 colors=0 analyze=0", engineName)
+		c.send("feature option=\"Engine -combo *AI /// AI2\"")
+		c.send("feature option=\"NullMove -check %d\"", boolToCheck(S.NullMovePruning))
+		c.send("feature option=\"NullMoveVerification -check %d\"", boolToCheck(S.NullMoveVerification))
+		c.send("feature option=\"ReverseFutility -check %d\"", boolToCheck(S.ReverseFutilityPruning))
+		c.send("feature option=\"Futility -check %d\"", boolToCheck(S.FutilityPruning))
+		c.send("feature option=\"Razoring -check %d\"", boolToCheck(S.Razoring))
+		c.send("feature option=\"DeltaPruning -check %d\"", boolToCheck(S.DeltaPruning))
+		c.send("feature option=\"Contempt -spin %d %d %d\"", S.Contempt, -maxContempt, maxContempt)
+		c.send("feature done=1")
+	case "ping":
+		c.send("pong %s", strings.Join(args, " "))
+	case "post":
+		c.post = true
+	case "nopost":
+		c.post = false
+	case "time":
+		c.engineClock = centiseconds(args)
+	case "otim":
+	case "?":
+		c.stopSearch(false)
+	case "new":
+		c.stopSearch(true)
+		for _, clear := range c.clear {
+			clear()
+		}
+		c.newGame()
+	case "setboard":
+		c.stopSearch(true)
+		c.setBoard(strings.Join(args, " "))
+	case "force":
+		c.stopSearch(true)
+		c.forceMode = true
+	case "go":
+		c.stopSearch(true)
+		c.forceMode = false
+		c.engineColor = c.game.Position().Turn()
+		c.think()
+	case "usermove":
+		c.stopSearch(true)
+		c.userMove(args)
+	case "undo":
+		c.stopSearch(true)
+		c.undo(1)
+	case "remove":
+		c.stopSearch(true)
+		c.undo(2)
+	case "result":
+		c.stopSearch(true)
+		c.forceMode = true
+	case "level":
+		c.level(args)
+	case "st":
+		if len(args) > 0 {
+			seconds, _ := strconv.ParseFloat(args[0], 64)
+			c.moveTime = time.Duration(seconds * float64(time.Second))
+		}
+	case "sd":
+		if len(args) > 0 {
+			if depth, err := strconv.Atoi(args[0]); err == nil && depth > 0 {
+				c.maxDepth = depth
+			}
+		}
+	case "cores":
+		if len(args) > 0 {
+			if cores, err := strconv.Atoi(args[0]); err == nil && cores > 0 && cores <= maxThreads {
+				S.Threads = cores
+				V.Threads = cores
+			}
+		}
+	case "option":
+		c.option(strings.Join(args, " "))
+	case "quit":
+		c.stopSearch(true)
+		return false
+	default:
+		c.send("Error (unknown command): %s", fields[0])
+	}
+
+	return true
+}
+
+func (c *CECP) send(format string, args ...interface{}) {
+	c.outMutex.Lock()
+	defer c.outMutex.Unlock()
+	fmt.Fprintf(c.out, format+"\n", args...)
+}
+
+// centiseconds parses the argument of "time" and "otim".
+func centiseconds(args []string) time.Duration {
+	if len(args) == 0 {
+		return 0
+	}
+	cs, _ := strconv.Atoi(args[0])
+	return time.Duration(cs) * 10 * time.Millisecond
+}
+
+func (c *CECP) newGame() {
+	c.startFEN = ""
+	c.game = chess.NewGame(chess.UseNotation(chess.UCINotation{}))
+	c.movesPlayed = []string{}
+	c.forceMode = false
+	c.engineColor = chess.Black
+	c.maxDepth = maxSearchDepth
+	c.moveTime = 0
+}
+
+func (c *CECP) setBoard(fen string) {
+	game, err := newGameFromFEN(fen)
+	if err != nil {
+		c.send("tellusererror Illegal position")
+		return
+	}
+	c.startFEN = fen
+	c.game = game
+	c.movesPlayed = []string{}
+}
+
+func newGameFromFEN(fen string) (*chess.Game, error) {
+	options := []func(*chess.Game){chess.UseNotation(chess.UCINotation{})}
+	if fen != "" {
+		fenOption, err := chess.FEN(fen)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, fenOption)
+	}
+	return chess.NewGame(options...), nil
+}
+
+func (c *CECP) userMove(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	if err := c.game.MoveStr(args[0]); err != nil {
+		c.send("Illegal move: %s", args[0])
+		return
+	}
+	c.movesPlayed = append(c.movesPlayed, args[0])
+
+	if c.reportResult() {
+		return
+	}
+	if !c.forceMode && c.game.Position().Turn() == c.engineColor {
+		c.think()
+	}
+}
+
+// undo takes back the last n moves by replaying the game from its start position.
+func (c *CECP) undo(n int) {
+	if n > len(c.movesPlayed) {
+		n = len(c.movesPlayed)
+	}
+	moves := c.movesPlayed[:len(c.movesPlayed)-n]
+
+	game, _ := newGameFromFEN(c.startFEN)
+	for _, move := range moves {
+		game.MoveStr(move)
+	}
+	c.game = game
+	c.movesPlayed = append([]string(nil), moves...)
+}
+
+// level handles "level MPS BASE INC" where BASE is minutes or minutes:seconds.
+func (c *CECP) level(args []string) {
+	if len(args) < 3 {
+		return
+	}
+	c.movesPerPeriod, _ = strconv.Atoi(args[0])
+	c.moveTime = 0
+
+	minutes, seconds := args[1], "0"
+	if i := strings.Index(minutes, ":"); i >= 0 {
+		minutes, seconds = minutes[:i], minutes[i+1:]
+	}
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	c.engineClock = time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+
+	inc, _ := strconv.ParseFloat(args[2], 64)
+	c.increment = time.Duration(inc * float64(time.Second))
+}
+
+func (c *CECP) option(setting string) {
+	name, value := setting, ""
+	if i := strings.Index(setting, "="); i >= 0 {
+		name, value = setting[:i], setting[i+1:]
+	}
+
+	switch name {
+	case "Engine":
+		if _, ok := c.engines[value]; ok {
+			c.engine = value
+		}
+	case "NullMove":
+		S.NullMovePruning = value == "1"
+		V.NullMovePruning = value == "1"
+	case "NullMoveVerification":
+		S.NullMoveVerification = value == "1"
+		V.NullMoveVerification = value == "1"
+	case "ReverseFutility":
+		S.ReverseFutilityPruning = value == "1"
+		V.ReverseFutilityPruning = value == "1"
+	case "Futility":
+		S.FutilityPruning = value == "1"
+		V.FutilityPruning = value == "1"
+	case "Razoring":
+		S.Razoring = value == "1"
+		V.Razoring = value == "1"
+	case "DeltaPruning":
+		S.DeltaPruning = value == "1"
+		V.DeltaPruning = value == "1"
+	case "Contempt":
+		if contempt, err := strconv.Atoi(value); err == nil && contempt >= -maxContempt && contempt <= maxContempt {
+			S.Contempt = contempt
+			V.Contempt = contempt
+		}
+	default:
+		c.send("Error (unknown option): %s", name)
+	}
+}
+
+// cecpScore writes a mate score the way xboard expects it, 100000+N for a mate in N
+// moves and -100000-N for getting mated in N. Other scores are left as they are.
+func cecpScore(score int, mateIn func(int) (int, bool)) int {
+	moves, ok := mateIn(score)
+	switch {
+	case !ok:
+		return score
+	case moves > 0:
+		return 100000 + moves
+	}
+	return -100000 + moves
+}
+
+// boolToCheck turns a setting into the value of an xboard check option.
+func boolToCheck(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// timeControl describes the engine's clock for its next move. Without a clock or "st"
+// it falls back to defaultMoveTime per move.
+func (c *CECP) timeControl() util.TimeControl {
+	tc := util.TimeControl{
+		Remaining: c.engineClock,
+		Increment: c.increment,
+		MoveTime:  c.moveTime,
+		Ply:       len(c.game.Moves()),
+	}
+	if c.movesPerPeriod > 0 {
+		tc.MovesToGo = c.movesPerPeriod - (len(c.game.Moves())/2)%c.movesPerPeriod
+	}
+	if tc.MoveTime <= 0 && tc.Remaining <= 0 {
+		tc.MoveTime = defaultMoveTime
+	}
+	return tc
+}
+
+// think starts a search in the background and plays its move unless it is aborted.
+func (c *CECP) think() {
+	c.abort = false
+
+	think := c.engines[c.engine]
+	game := c.game
+	maxDepth := c.maxDepth
+	post := c.post
+	root := game.Position()
+
+	timeManager := util.NewTimeManager(c.timeControl(), len(game.ValidMoves()))
+	ctx, cancel := context.WithTimeout(context.Background(), timeManager.HardLimit())
+	c.cancel = cancel
+
+	c.searching.Add(1)
+	go func() {
+		defer c.searching.Done()
+
+		bestMove := think(ctx, game, maxDepth, func(depth, score, nodes int, elapsed time.Duration, pv []*chess.Move) bool {
+			if len(pv) == 0 {
+				return timeManager.Continue(score, nil)
+			}
+			if post {
+				c.send("%d %d %d %d %s", depth, score, elapsed.Milliseconds()/10, nodes, util.FormatPV(root, pv, chess.AlgebraicNotation{}))
+			}
+			return timeManager.Continue(score, pv[0])
+		})
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.abort || bestMove == nil {
+			return
+		}
+		if err := c.game.Move(bestMove); err != nil {
+			return
+		}
+		c.movesPlayed = append(c.movesPlayed, bestMove.String())
+		c.send("move %s", bestMove)
+		c.reportResult()
+	}()
+}
+
+// stopSearch interrupts the running search, if any, and waits for it. When abort is
+// set the search result is thrown away instead of being played.
+func (c *CECP) stopSearch(abort bool) {
+	if c.cancel == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.abort = abort
+	c.mutex.Unlock()
+
+	c.cancel()
+	c.searching.Wait()
+	c.cancel = nil
+}
+
+// reportResult sends the game result once the game is over and reports whether it was.
+func (c *CECP) reportResult() bool {
+	switch c.game.Outcome() {
+	case chess.WhiteWon:
+		c.send("1-0 {White mates}")
+	case chess.BlackWon:
+		c.send("0-1 {Black mates}")
+	case chess.Draw:
+		c.send("1/2-1/2 {%s}", c.game.Method())
+	default:
+		return false
+	}
+	return true
+}
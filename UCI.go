@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	S "DCAI.com/packages/AI"
+	"DCAI.com/packages/util"
+	"github.com/notnil/chess"
+)
+
+const (
+	engineName   = "DCAI"
+	engineAuthor = "Dimitris Pantzopoulos"
+
+	defaultHashMB  = 64
+	maxHashMB      = 4096
+	maxThreads     = 256
+	maxContempt    = 200
+	maxSearchDepth = 64
+)
+
+// UCI drives the AI engine over the Universal Chess Interface protocol.
+type UCI struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	outMutex sync.Mutex
+
+	game *chess.Game
+	tt   *S.TranspositionTable
+
+	// cancel interrupts the current search on "stop" (or any command that needs
+	// the search finished) and searching tracks the goroutine running it.
+	cancel    context.CancelFunc
+	searching sync.WaitGroup
+}
+
+// uciLimits holds the parameters of a "go" command.
+type uciLimits struct {
+	wtime, btime time.Duration
+	winc, binc   time.Duration
+	movesToGo    int
+	moveTime     time.Duration
+	depth        int
+	nodes        int
+	infinite     bool
+}
+
+func NewUCI(in io.Reader, out io.Writer) *UCI {
+	u := &UCI{
+		in:  bufio.NewScanner(in),
+		out: out,
+		tt:  S.NewTranspositionTable(defaultHashMB),
+	}
+	u.newGame()
+	return u
+}
+
+// Loop reads commands until "quit" or the end of the input.
+func (u *UCI) Loop() {
+	for u.in.Scan() {
+		if !u.Execute(u.in.Text()) {
+			return
+		}
+	}
+	u.stopSearch()
+}
+
+// Execute handles a single command line and reports whether the loop should continue.
+func (u *UCI) Execute(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		u.send("id name %s", engineName)
+		u.send("id author %s", engineAuthor)
+		u.send("option name Hash type spin default %d min 1 max %d", defaultHashMB, maxHashMB)
+		u.send("option name Clear Hash type button")
+		u.send("option name Threads type spin default 1 min 1 max %d", maxThreads)
+		u.send("option name NullMove type check default %t", S.NullMovePruning)
+		u.send("option name NullMoveVerification type check default %t", S.NullMoveVerification)
+		u.send("option name ReverseFutility type check default %t", S.ReverseFutilityPruning)
+		u.send("option name Futility type check default %t", S.FutilityPruning)
+		u.send("option name Razoring type check default %t", S.Razoring)
+		u.send("option name DeltaPruning type check default %t", S.DeltaPruning)
+		u.send("option name Contempt type spin default %d min %d max %d", S.Contempt, -maxContempt, maxContempt)
+		u.send("uciok")
+	case "isready":
+		u.send("readyok")
+	case "ucinewgame":
+		u.stopSearch()
+		S.ClearTranspositionTable(u.tt)
+		u.newGame()
+	case "position":
+		u.stopSearch()
+		u.position(fields[1:])
+	case "go":
+		u.stopSearch()
+		u.goCommand(fields[1:])
+	case "stop":
+		u.stopSearch()
+	case "setoption":
+		u.stopSearch()
+		u.setOption(fields[1:])
+	case "perft", "divide":
+		u.stopSearch()
+		u.perft(fields[0] == "divide", fields[1:])
+	case "bench":
+		u.stopSearch()
+		u.bench(fields[1:])
+	case "quit":
+		u.stopSearch()
+		return false
+	default:
+		u.send("info string unknown command %s", fields[0])
+	}
+
+	return true
+}
+
+func (u *UCI) send(format string, args ...interface{}) {
+	u.outMutex.Lock()
+	defer u.outMutex.Unlock()
+	fmt.Fprintf(u.out, format+"\n", args...)
+}
+
+func (u *UCI) newGame() {
+	u.game = chess.NewGame(chess.UseNotation(chess.UCINotation{}))
+}
+
+// position handles "position [startpos | fen <fen>] [moves <m1> ... <mN>]".
+func (u *UCI) position(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	options := []func(*chess.Game){chess.UseNotation(chess.UCINotation{})}
+	i := 1
+
+	switch args[0] {
+	case "startpos":
+	case "fen":
+		for i < len(args) && args[i] != "moves" {
+			i++
+		}
+		fen, err := chess.FEN(strings.Join(args[1:i], " "))
+		if err != nil {
+			u.send("info string invalid fen: %v", err)
+			return
+		}
+		options = append(options, fen)
+	default:
+		u.send("info string invalid position command")
+		return
+	}
+
+	game := chess.NewGame(options...)
+
+	if i < len(args) && args[i] == "moves" {
+		for _, moveStr := range args[i+1:] {
+			if err := game.MoveStr(moveStr); err != nil {
+				u.send("info string invalid move %s", moveStr)
+				break
+			}
+		}
+	}
+
+	u.game = game
+}
+
+// setOption handles "setoption name <id> [value <x>]".
+func (u *UCI) setOption(args []string) {
+	var name, value []string
+	var target *[]string
+
+	for _, arg := range args {
+		switch arg {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			if target != nil {
+				*target = append(*target, arg)
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "hash":
+		mb, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || mb < 1 || mb > maxHashMB {
+			u.send("info string invalid Hash value")
+			return
+		}
+		u.tt = S.NewTranspositionTable(mb)
+	case "clear hash":
+		S.ClearTranspositionTable(u.tt)
+	case "threads":
+		threads, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || threads < 1 || threads > maxThreads {
+			u.send("info string invalid Threads value")
+			return
+		}
+		S.Threads = threads
+	case "nullmove":
+		S.NullMovePruning = strings.Join(value, "") == "true"
+	case "nullmoveverification":
+		S.NullMoveVerification = strings.Join(value, "") == "true"
+	case "reversefutility":
+		S.ReverseFutilityPruning = strings.Join(value, "") == "true"
+	case "futility":
+		S.FutilityPruning = strings.Join(value, "") == "true"
+	case "razoring":
+		S.Razoring = strings.Join(value, "") == "true"
+	case "deltapruning":
+		S.DeltaPruning = strings.Join(value, "") == "true"
+	case "contempt":
+		contempt, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || contempt < -maxContempt || contempt > maxContempt {
+			u.send("info string invalid Contempt value")
+			return
+		}
+		S.Contempt = contempt
+	default:
+		u.send("info string unknown option %s", strings.Join(name, " "))
+	}
+}
+
+// perft handles "perft <depth>" and "divide <depth>" on the current position.
+func (u *UCI) perft(divide bool, args []string) {
+	depth := 1
+	if len(args) > 0 {
+		depth, _ = strconv.Atoi(args[0])
+	}
+
+	start := time.Now()
+	nodes := 0
+	if divide {
+		for _, division := range util.Divide(u.game, depth) {
+			u.send("%s: %d", division.Move, division.Nodes)
+			nodes += division.Nodes
+		}
+	} else {
+		nodes = util.Perft(u.game, depth)
+	}
+
+	u.send("")
+	u.send("Nodes searched: %d", nodes)
+	u.send("Time: %d ms, %d nps", time.Since(start).Milliseconds(), nodesPerSecond(nodes, time.Since(start)))
+}
+
+// bench handles "bench [depth]", searching the bench positions to a fixed depth with
+// null-move pruning off and then on, and comparing the nodes it took.
+func (u *UCI) bench(args []string) {
+	depth := 6
+	if len(args) > 0 {
+		depth, _ = strconv.Atoi(args[0])
+	}
+
+	saved := S.NullMovePruning
+	defer func() { S.NullMovePruning = saved }()
+
+	var totals [2]int
+	start := time.Now()
+
+	for _, position := range util.BenchPositions {
+		game, err := newGameFromFEN(position.FEN)
+		if err != nil {
+			u.send("%s: invalid fen: %v", position.Name, err)
+			continue
+		}
+
+		var nodes [2]int
+		for i, enabled := range []bool{false, true} {
+			S.NullMovePruning = enabled
+			_, _, nodes[i], _ = S.IterativeDeepening(context.Background(), game, depth, 0, S.NewTranspositionTable(16), nil)
+			totals[i] += nodes[i]
+		}
+		u.send("%s depth %d: %d nodes without null move, %d with", position.Name, depth, nodes[0], nodes[1])
+	}
+
+	reduction := 0.0
+	if totals[0] > 0 {
+		reduction = 100 * float64(totals[0]-totals[1]) / float64(totals[0])
+	}
+	u.send("bench: %d nodes without null move, %d with, %.1f%% fewer, %d ms", totals[0], totals[1], reduction, time.Since(start).Milliseconds())
+}
+
+func nodesPerSecond(nodes int, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return int64(nodes)
+	}
+	return int64(float64(nodes) / elapsed.Seconds())
+}
+
+func parseLimits(args []string) uciLimits {
+	var limits uciLimits
+
+	for i := 0; i < len(args); i++ {
+		// Every parameter other than "infinite" takes a numeric value.
+		value := 0
+		if i+1 < len(args) {
+			value, _ = strconv.Atoi(args[i+1])
+		}
+		ms := time.Duration(value) * time.Millisecond
+
+		switch args[i] {
+		case "wtime":
+			limits.wtime = ms
+		case "btime":
+			limits.btime = ms
+		case "winc":
+			limits.winc = ms
+		case "binc":
+			limits.binc = ms
+		case "movestogo":
+			limits.movesToGo = value
+		case "movetime":
+			limits.moveTime = ms
+		case "depth":
+			limits.depth = value
+		case "nodes":
+			limits.nodes = value
+		case "infinite":
+			limits.infinite = true
+			continue
+		default:
+			continue
+		}
+		i++
+	}
+
+	return limits
+}
+
+// timeControl returns the clock of the side to move, or false when there is neither a
+// clock nor a movetime and the search is only bounded by depth, nodes or "stop".
+func (l uciLimits) timeControl(turn chess.Color, ply int) (util.TimeControl, bool) {
+	remaining, increment := l.wtime, l.winc
+	if turn == chess.Black {
+		remaining, increment = l.btime, l.binc
+	}
+
+	tc := util.TimeControl{
+		Remaining: remaining,
+		Increment: increment,
+		MovesToGo: l.movesToGo,
+		MoveTime:  l.moveTime,
+		Ply:       ply,
+	}
+	return tc, !l.infinite && (l.moveTime > 0 || remaining > 0)
+}
+
+// goCommand starts a search in the background. The bestmove is printed when it
+// finishes, except under "go infinite" where it waits for "stop" as the protocol requires.
+func (u *UCI) goCommand(args []string) {
+	limits := parseLimits(args)
+
+	maxDepth := maxSearchDepth
+	if limits.depth > 0 {
+		maxDepth = limits.depth
+	}
+
+	game := u.game
+	tt := u.tt
+
+	var timeManager *util.TimeManager
+	ctx, cancel := context.WithCancel(context.Background())
+	if tc, ok := limits.timeControl(game.Position().Turn(), len(game.Moves())); ok {
+		timeManager = util.NewTimeManager(tc, len(game.ValidMoves()))
+		timeoutCtx, cancelTimeout := context.WithTimeout(ctx, timeManager.HardLimit())
+		cancelSearch := cancel
+		ctx, cancel = timeoutCtx, func() {
+			cancelTimeout()
+			cancelSearch()
+		}
+	}
+	u.cancel = cancel
+
+	u.searching.Add(1)
+	go func() {
+		defer u.searching.Done()
+
+		_, bestMove, _, _ := S.IterativeDeepening(ctx, game, maxDepth, limits.nodes, tt, func(info S.SearchInfo) bool {
+			u.sendInfo(info, tt.Hashfull(), game.Position())
+			if info.Bound != S.ExactScore {
+				return true
+			}
+			return timeManager == nil || timeManager.Continue(info.Score, info.BestMove)
+		})
+
+		if limits.infinite {
+			<-ctx.Done()
+		}
+
+		if bestMove == nil {
+			u.send("bestmove 0000")
+			return
+		}
+		u.send("bestmove %s", bestMove)
+	}()
+}
+
+func (u *UCI) sendInfo(info S.SearchInfo, hashfull int, root *chess.Position) {
+	ms := info.Elapsed.Milliseconds()
+	nps := nodesPerSecond(info.Nodes, info.Elapsed)
+
+	pv := ""
+	if len(info.PV) > 0 {
+		pv = " pv " + util.FormatPV(root, info.PV, chess.UCINotation{})
+	}
+
+	score := fmt.Sprintf("cp %d", info.Score)
+	if moves, ok := S.MateIn(info.Score); ok {
+		score = fmt.Sprintf("mate %d", moves)
+	}
+
+	bound := ""
+	switch info.Bound {
+	case S.LowerBound:
+		bound = " lowerbound"
+	case S.UpperBound:
+		bound = " upperbound"
+	}
+
+	u.send("info depth %d score %s%s nodes %d nps %d hashfull %d time %d%s", info.Depth, score, bound, info.Nodes, nps, hashfull, ms, pv)
+}
+
+// stopSearch interrupts the running search, if any, and waits for its bestmove.
+func (u *UCI) stopSearch() {
+	if u.cancel == nil {
+		return
+	}
+	u.cancel()
+	u.searching.Wait()
+	u.cancel = nil
+}
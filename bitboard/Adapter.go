@@ -0,0 +1,163 @@
+package bitboard
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Conversions between this package and notnil/chess, so search and evaluation code
+// can switch to Position piece by piece while the rest still uses chess.Game.
+
+var chessPieceTypes = [...]chess.PieceType{chess.Pawn, chess.Knight, chess.Bishop, chess.Rook, chess.Queen, chess.King}
+
+// ToChessPiece returns the notnil/chess equivalent of p.
+func ToChessPiece(p Piece) chess.Piece {
+	if p == NoPiece {
+		return chess.NoPiece
+	}
+	color := chess.White
+	if p.Color() == Black {
+		color = chess.Black
+	}
+	return chess.NewPiece(chessPieceTypes[p.Type()], color)
+}
+
+// FromChessPiece returns the Piece equivalent of a notnil/chess piece.
+func FromChessPiece(p chess.Piece) Piece {
+	if p == chess.NoPiece {
+		return NoPiece
+	}
+	c := White
+	if p.Color() == chess.Black {
+		c = Black
+	}
+	return MakePiece(c, fromChessPieceType(p.Type()))
+}
+
+func fromChessPieceType(pt chess.PieceType) PieceType {
+	for i, t := range chessPieceTypes {
+		if t == pt {
+			return PieceType(i)
+		}
+	}
+	return NoPieceType
+}
+
+// chessBoardPieces is the order of the bitboards in chess.Position.MarshalBinary.
+var chessBoardPieces = [...]chess.Piece{
+	chess.WhiteKing, chess.WhiteQueen, chess.WhiteRook, chess.WhiteBishop, chess.WhiteKnight, chess.WhitePawn,
+	chess.BlackKing, chess.BlackQueen, chess.BlackRook, chess.BlackBishop, chess.BlackKnight, chess.BlackPawn,
+}
+
+// FromChess converts a notnil/chess position straight from its bitboards, without going
+// through FEN. The two share Zobrist keys, so the result hashes to
+// util.ZobristHash(position). Like ParseFEN it rejects a position without exactly one
+// king per side, which notnil/chess accepts but this package cannot search.
+func FromChess(position *chess.Position) (*Position, error) {
+	// The board takes 96 bytes, then come the halfmove clock and the fullmove number.
+	data, err := position.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Position{epSquare: NoSquare, halfmove: position.HalfMoveClock(), fullmove: int(binary.BigEndian.Uint16(data[97:]))}
+	for sq := range p.board {
+		p.board[sq] = NoPiece
+	}
+	for i, piece := range chessBoardPieces {
+		// notnil/chess keeps square n in bit 63-n.
+		for bb := Bitboard(bits.Reverse64(binary.BigEndian.Uint64(data[i*8:]))); bb != 0; {
+			p.putPiece(FromChessPiece(piece), bb.PopLSB())
+		}
+	}
+	if p.pieces[White][King].Count() != 1 || p.pieces[Black][King].Count() != 1 {
+		return nil, fmt.Errorf("position %q: each side needs exactly one king", position)
+	}
+
+	if position.Turn() == chess.Black {
+		p.side = Black
+		p.hash ^= sideKey
+	}
+
+	for i, c := range "KQkq" {
+		if strings.ContainsRune(string(position.CastleRights()), c) {
+			p.castling |= 1 << i
+		}
+	}
+	p.hash ^= castleKeys[p.castling]
+
+	if ep := position.EnPassantSquare(); ep != chess.NoSquare {
+		p.epSquare = Square(ep)
+		if p.epCapturable() {
+			p.hash ^= enPassantKeys[p.epSquare.File()]
+		}
+	}
+
+	return p, nil
+}
+
+// ToChess converts the position to notnil/chess. The move history is not carried over.
+func (p *Position) ToChess() (*chess.Position, error) {
+	fen, err := chess.FEN(p.FEN())
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(fen).Position(), nil
+}
+
+// FromChessMove returns the legal Move of p that has the same squares and promotion as
+// move, or false if there is none.
+func (p *Position) FromChessMove(move *chess.Move) (Move, bool) {
+	from, to := Square(move.S1()), Square(move.S2())
+	promo := NoPieceType
+	if move.Promo() != chess.NoPieceType {
+		promo = fromChessPieceType(move.Promo())
+	}
+
+	for _, m := range p.LegalMoves() {
+		if m.From() == from && m.To() == to && m.Promo() == promo {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// ConvertMove builds the Move for a notnil/chess move from its squares, promotion and
+// tags, without generating the legal moves. The move must come from ValidMoves.
+func ConvertMove(move *chess.Move) Move {
+	var flags MoveFlag
+	if move.HasTag(chess.Capture) || move.HasTag(chess.EnPassant) {
+		flags |= FlagCapture
+	}
+	if move.HasTag(chess.EnPassant) {
+		flags |= FlagEnPassant
+	}
+	if move.HasTag(chess.KingSideCastle) || move.HasTag(chess.QueenSideCastle) {
+		flags |= FlagCastle
+	}
+
+	promo := NoPieceType
+	if move.Promo() != chess.NoPieceType {
+		promo = fromChessPieceType(move.Promo())
+	}
+	return NewMove(Square(move.S1()), Square(move.S2()), promo, flags)
+}
+
+// ToChessMove returns the valid move of position matching m, or nil if there is none.
+func ToChessMove(position *chess.Position, m Move) *chess.Move {
+	promo := chess.NoPieceType
+	if m.IsPromotion() {
+		promo = chessPieceTypes[m.Promo()]
+	}
+
+	for _, move := range position.ValidMoves() {
+		if Square(move.S1()) == m.From() && Square(move.S2()) == m.To() && move.Promo() == promo {
+			return move
+		}
+	}
+	return nil
+}
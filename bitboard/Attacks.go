@@ -0,0 +1,179 @@
+package bitboard
+
+// magicSeed is fixed so the magic search finds the same numbers on every run.
+const magicSeed = 0xDCA1
+
+var (
+	knightAttacks [64]Bitboard
+	kingAttacks   [64]Bitboard
+	pawnAttacks   [2][64]Bitboard
+
+	rookMagics   [64]magic
+	bishopMagics [64]magic
+
+	rookDirections   = [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirections = [4][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// magic maps every relevant occupancy of a slider's rays to its attack set with one
+// multiply and shift.
+type magic struct {
+	mask    Bitboard
+	number  uint64
+	shift   uint8
+	attacks []Bitboard
+}
+
+func (m *magic) index(occupied Bitboard) uint64 {
+	return (uint64(occupied&m.mask) * m.number) >> m.shift
+}
+
+func init() {
+	for sq := A1; sq <= H8; sq++ {
+		b := SquareBB(sq)
+
+		knightAttacks[sq] = stepAttacks(sq, [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}})
+		kingAttacks[sq] = stepAttacks(sq, [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}})
+		pawnAttacks[White][sq] = East(North(b)) | West(North(b))
+		pawnAttacks[Black][sq] = East(South(b)) | West(South(b))
+	}
+
+	rng := uint64(magicSeed)
+	for sq := A1; sq <= H8; sq++ {
+		initMagic(&rookMagics[sq], sq, rookDirections, &rng)
+		initMagic(&bishopMagics[sq], sq, bishopDirections, &rng)
+	}
+}
+
+// stepAttacks returns the squares one jump away from sq for each offset that stays on the board.
+func stepAttacks(sq Square, offsets [][2]int) Bitboard {
+	var attacks Bitboard
+	for _, d := range offsets {
+		file, rank := sq.File()+d[0], sq.Rank()+d[1]
+		if file >= 0 && file < 8 && rank >= 0 && rank < 8 {
+			attacks |= SquareBB(NewSquare(file, rank))
+		}
+	}
+	return attacks
+}
+
+// slidingAttacks walks each ray from sq until it leaves the board or hits a piece. It
+// is only used to fill the magic tables.
+func slidingAttacks(sq Square, occupied Bitboard, directions [4][2]int) Bitboard {
+	var attacks Bitboard
+	for _, d := range directions {
+		file, rank := sq.File()+d[0], sq.Rank()+d[1]
+		for file >= 0 && file < 8 && rank >= 0 && rank < 8 {
+			to := NewSquare(file, rank)
+			attacks |= SquareBB(to)
+			if occupied.Has(to) {
+				break
+			}
+			file, rank = file+d[0], rank+d[1]
+		}
+	}
+	return attacks
+}
+
+// initMagic finds a magic number for sq by trial, keeping the first sparse random
+// number that sends no two occupancies with different attacks to the same entry.
+func initMagic(m *magic, sq Square, directions [4][2]int, rng *uint64) {
+	// The last square of each ray never changes the attacks, so leave the edges out.
+	edges := ((Rank1BB | Rank8BB) &^ RankBB(sq.Rank())) | ((FileABB | FileHBB) &^ FileBB(sq.File()))
+	m.mask = slidingAttacks(sq, 0, directions) &^ edges
+	bitCount := m.mask.Count()
+	m.shift = uint8(64 - bitCount)
+
+	// Enumerate every subset of the mask with the Carry-Rippler trick.
+	size := 1 << bitCount
+	occupancies := make([]Bitboard, 0, size)
+	references := make([]Bitboard, 0, size)
+	var subset Bitboard
+	for {
+		occupancies = append(occupancies, subset)
+		references = append(references, slidingAttacks(sq, subset, directions))
+		subset = (subset - m.mask) & m.mask
+		if subset == 0 {
+			break
+		}
+	}
+
+	m.attacks = make([]Bitboard, size)
+	used := make([]int, size)
+	for attempt := 1; ; attempt++ {
+		m.number = nextRandom(rng) & nextRandom(rng) & nextRandom(rng)
+		if Bitboard((uint64(m.mask)*m.number)>>56).Count() < 6 {
+			continue
+		}
+
+		ok := true
+		for i, occupied := range occupancies {
+			idx := m.index(occupied)
+			if used[idx] != attempt {
+				used[idx] = attempt
+				m.attacks[idx] = references[i]
+			} else if m.attacks[idx] != references[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return
+		}
+	}
+}
+
+// nextRandom is a xorshift generator, enough for finding magics.
+func nextRandom(state *uint64) uint64 {
+	x := *state
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	*state = x
+	return x * 2685821657736338717
+}
+
+func KnightAttacks(sq Square) Bitboard {
+	return knightAttacks[sq]
+}
+
+func KingAttacks(sq Square) Bitboard {
+	return kingAttacks[sq]
+}
+
+// PawnAttacks returns the squares a pawn of colour c on sq attacks.
+func PawnAttacks(c Color, sq Square) Bitboard {
+	return pawnAttacks[c][sq]
+}
+
+func BishopAttacks(sq Square, occupied Bitboard) Bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func RookAttacks(sq Square, occupied Bitboard) Bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func QueenAttacks(sq Square, occupied Bitboard) Bitboard {
+	return BishopAttacks(sq, occupied) | RookAttacks(sq, occupied)
+}
+
+// Attacks returns the squares a knight, bishop, rook, queen or king on sq attacks.
+// Pawn attacks depend on colour, see PawnAttacks.
+func Attacks(pt PieceType, sq Square, occupied Bitboard) Bitboard {
+	switch pt {
+	case Knight:
+		return KnightAttacks(sq)
+	case Bishop:
+		return BishopAttacks(sq, occupied)
+	case Rook:
+		return RookAttacks(sq, occupied)
+	case Queen:
+		return QueenAttacks(sq, occupied)
+	case King:
+		return KingAttacks(sq)
+	}
+	return 0
+}
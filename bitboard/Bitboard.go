@@ -0,0 +1,70 @@
+// Package bitboard is a native board representation and move generator. Positions
+// are made and unmade in place instead of being cloned, and sliding attacks come
+// from magic bitboards. Adapter.go converts to and from notnil/chess so the engines
+// can move over one piece at a time.
+package bitboard
+
+import "math/bits"
+
+// Bitboard is a set of squares, bit n standing for square n (A1 = 0, H8 = 63).
+type Bitboard uint64
+
+const (
+	FileABB Bitboard = 0x0101010101010101
+	FileHBB Bitboard = FileABB << 7
+	Rank1BB Bitboard = 0xFF
+	Rank2BB Bitboard = Rank1BB << 8
+	Rank4BB Bitboard = Rank1BB << 24
+	Rank5BB Bitboard = Rank1BB << 32
+	Rank7BB Bitboard = Rank1BB << 48
+	Rank8BB Bitboard = Rank1BB << 56
+)
+
+// SquareBB returns the bitboard holding only sq.
+func SquareBB(sq Square) Bitboard {
+	return Bitboard(1) << sq
+}
+
+// Has reports whether sq is in the set.
+func (b Bitboard) Has(sq Square) bool {
+	return b&SquareBB(sq) != 0
+}
+
+// Count returns the number of squares in the set.
+func (b Bitboard) Count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// LSB returns the lowest square in the set, which must not be empty.
+func (b Bitboard) LSB() Square {
+	return Square(bits.TrailingZeros64(uint64(b)))
+}
+
+// MSB returns the highest square in the set, which must not be empty.
+func (b Bitboard) MSB() Square {
+	return Square(63 - bits.LeadingZeros64(uint64(b)))
+}
+
+// PopLSB removes the lowest square from the set and returns it.
+func (b *Bitboard) PopLSB() Square {
+	sq := b.LSB()
+	*b &= *b - 1
+	return sq
+}
+
+// FileBB returns every square on the given file (0 = a).
+func FileBB(file int) Bitboard {
+	return FileABB << file
+}
+
+// RankBB returns every square on the given rank (0 = 1st rank).
+func RankBB(rank int) Bitboard {
+	return Rank1BB << (8 * rank)
+}
+
+// Shifts that drop whatever falls off the board instead of wrapping to the other side.
+
+func North(b Bitboard) Bitboard { return b << 8 }
+func South(b Bitboard) Bitboard { return b >> 8 }
+func East(b Bitboard) Bitboard  { return (b &^ FileHBB) << 1 }
+func West(b Bitboard) Bitboard  { return (b &^ FileABB) >> 1 }
@@ -0,0 +1,481 @@
+package bitboard
+
+import (
+	"DCAI.com/packages/util"
+	"github.com/notnil/chess"
+)
+
+// The static evaluation both engines search with. It reads a notnil/chess board and
+// scores it with this package's attack sets, so that it only has to be tuned once.
+
+// MG_VALUES and EG_VALUES are the piece values in the middlegame and in the endgame,
+// indexed by chess.PieceType. The king has no material value.
+var MG_VALUES = [7]int{chess.Pawn: 82, chess.Knight: 337, chess.Bishop: 365, chess.Rook: 477, chess.Queen: 1025}
+var EG_VALUES = [7]int{chess.Pawn: 94, chess.Knight: 281, chess.Bishop: 297, chess.Rook: 512, chess.Queen: 936}
+
+// PHASE_WEIGHTS is what each piece adds to the game phase. With all pieces on the board
+// the phase is maxPhase, pure middlegame; with only kings and pawns left it is 0, pure
+// endgame.
+var PHASE_WEIGHTS = [7]int{chess.Knight: 1, chess.Bishop: 1, chess.Rook: 2, chess.Queen: 4}
+
+const maxPhase = 24
+
+// MG_TABLES and EG_TABLES are the middlegame and endgame piece-square tables (PeSTO's),
+// indexed by chess.PieceType. Each table is drawn as white sees the board, rank 8 in the
+// first row, and is read upside down for black.
+var MG_TABLES = [7][8][8]int{
+	chess.Pawn: {
+		{0, 0, 0, 0, 0, 0, 0, 0},
+		{98, 134, 61, 95, 68, 126, 34, -11},
+		{-6, 7, 26, 31, 65, 56, 25, -20},
+		{-14, 13, 6, 21, 23, 12, 17, -23},
+		{-27, -2, -5, 12, 17, 6, 10, -25},
+		{-26, -4, -4, -10, 3, 3, 33, -12},
+		{-35, -1, -20, -23, -15, 24, 38, -22},
+		{0, 0, 0, 0, 0, 0, 0, 0},
+	},
+	chess.Knight: {
+		{-167, -89, -34, -49, 61, -97, -15, -107},
+		{-73, -41, 72, 36, 23, 62, 7, -17},
+		{-47, 60, 37, 65, 84, 129, 73, 44},
+		{-9, 17, 19, 53, 37, 69, 18, 22},
+		{-13, 4, 16, 13, 28, 19, 21, -8},
+		{-23, -9, 12, 10, 19, 17, 25, -16},
+		{-29, -53, -12, -3, -1, 18, -14, -19},
+		{-105, -21, -58, -33, -17, -28, -19, -23},
+	},
+	chess.Bishop: {
+		{-29, 4, -82, -37, -25, -42, 7, -8},
+		{-26, 16, -18, -13, 30, 59, 18, -47},
+		{-16, 37, 43, 40, 35, 50, 37, -2},
+		{-4, 5, 19, 50, 37, 37, 7, -2},
+		{-6, 13, 13, 26, 34, 12, 10, 4},
+		{0, 15, 15, 15, 14, 27, 18, 10},
+		{4, 15, 16, 0, 7, 21, 33, 1},
+		{-33, -3, -14, -21, -13, -12, -39, -21},
+	},
+	chess.Rook: {
+		{32, 42, 32, 51, 63, 9, 31, 43},
+		{27, 32, 58, 62, 80, 67, 26, 44},
+		{-5, 19, 26, 36, 17, 45, 61, 16},
+		{-24, -11, 7, 26, 24, 35, -8, -20},
+		{-36, -26, -12, -1, 9, -7, 6, -23},
+		{-45, -25, -16, -17, 3, 0, -5, -33},
+		{-44, -16, -20, -9, -1, 11, -6, -71},
+		{-19, -13, 1, 17, 16, 7, -37, -26},
+	},
+	chess.Queen: {
+		{-28, 0, 29, 12, 59, 44, 43, 45},
+		{-24, -39, -5, 1, -16, 57, 28, 54},
+		{-13, -17, 7, 8, 29, 56, 47, 57},
+		{-27, -27, -16, -16, -1, 17, -2, 1},
+		{-9, -26, -9, -10, -2, -4, 3, -3},
+		{-14, 2, -11, -2, -5, 2, 14, 5},
+		{-35, -8, 11, 2, 8, 15, -3, 1},
+		{-1, -18, -9, 10, -15, -25, -31, -50},
+	},
+	chess.King: {
+		{-65, 23, 16, -15, -56, -34, 2, 13},
+		{29, -1, -20, -7, -8, -4, -38, -29},
+		{-9, 24, 2, -16, -20, 6, 22, -22},
+		{-17, -20, -12, -27, -30, -25, -14, -36},
+		{-49, -1, -27, -39, -46, -44, -33, -51},
+		{-14, -14, -22, -46, -44, -30, -15, -27},
+		{1, 7, -8, -64, -43, -16, 9, 8},
+		{-15, 36, 12, -54, 8, -28, 24, 14},
+	},
+}
+
+var EG_TABLES = [7][8][8]int{
+	chess.Pawn: {
+		{0, 0, 0, 0, 0, 0, 0, 0},
+		{178, 173, 158, 134, 147, 132, 165, 187},
+		{94, 100, 85, 67, 56, 53, 82, 84},
+		{32, 24, 13, 5, -2, 4, 17, 17},
+		{13, 9, -3, -7, -7, -8, 3, -1},
+		{4, 7, -6, 1, 0, -5, -1, -8},
+		{13, 8, 8, 10, 13, 0, 2, -7},
+		{0, 0, 0, 0, 0, 0, 0, 0},
+	},
+	chess.Knight: {
+		{-58, -38, -13, -28, -31, -27, -63, -99},
+		{-25, -8, -25, -2, -9, -25, -24, -52},
+		{-24, -20, 10, 9, -1, -9, -19, -41},
+		{-17, 3, 22, 22, 22, 11, 8, -18},
+		{-18, -6, 16, 25, 16, 17, 4, -18},
+		{-23, -3, -1, 15, 10, -3, -20, -22},
+		{-42, -20, -10, -5, -2, -20, -23, -44},
+		{-29, -51, -23, -15, -22, -18, -50, -64},
+	},
+	chess.Bishop: {
+		{-14, -21, -11, -8, -7, -9, -17, -24},
+		{-8, -4, 7, -12, -3, -13, -4, -14},
+		{2, -8, 0, -1, -2, 6, 0, 4},
+		{-3, 9, 12, 9, 14, 10, 3, 2},
+		{-6, 3, 13, 19, 7, 10, -3, -9},
+		{-12, -3, 8, 10, 13, 3, -7, -15},
+		{-14, -18, -7, -1, 4, -9, -15, -27},
+		{-23, -9, -23, -5, -9, -16, -5, -17},
+	},
+	chess.Rook: {
+		{13, 10, 18, 15, 12, 12, 8, 5},
+		{11, 13, 13, 11, -3, 3, 8, 3},
+		{7, 7, 7, 5, 4, -3, -5, -3},
+		{4, 3, 13, 1, 2, 1, -1, 2},
+		{3, 5, 8, 4, -5, -6, -8, -11},
+		{-4, 0, -5, -1, -7, -12, -8, -16},
+		{-6, -6, 0, 2, -9, -9, -11, -3},
+		{-9, 2, 3, -1, -5, -13, 4, -20},
+	},
+	chess.Queen: {
+		{-9, 22, 22, 27, 27, 19, 10, 20},
+		{-17, 20, 32, 41, 58, 25, 30, 0},
+		{-20, 6, 9, 49, 47, 35, 19, 9},
+		{3, 22, 24, 45, 57, 40, 57, 36},
+		{-18, 28, 19, 47, 31, 34, 39, 23},
+		{-16, -27, 15, 6, 9, 17, 10, 5},
+		{-22, -23, -30, -16, -16, -23, -36, -32},
+		{-33, -28, -22, -43, -5, -32, -20, -41},
+	},
+	chess.King: {
+		{-74, -35, -18, -18, -11, 15, 4, -17},
+		{-12, 17, 14, 17, 17, 38, 23, 11},
+		{10, 17, 23, 15, 20, 45, 44, 13},
+		{-8, 22, 24, 27, 26, 33, 26, 3},
+		{-18, -4, 21, 24, 27, 23, 9, -11},
+		{-19, -3, 11, 21, 23, 16, 7, -9},
+		{-27, -11, 4, 13, 14, 4, -5, -17},
+		{-53, -34, -21, -11, -28, -14, -24, -43},
+	},
+}
+
+// Eval scores the position for white: material, piece-square values, pawn structure,
+// king safety and mobility, blended by the game phase.
+func Eval(board *chess.Board) int {
+	var mg, eg [2]int
+	var pieces [2][6]Bitboard
+	var occupied Bitboard
+	var pawnKey uint64
+	phase := 0
+
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		piece := board.Piece(sq)
+		if piece == chess.NoPiece {
+			continue
+		}
+
+		side, row, file := White, 7-int(sq)/8, int(sq)%8
+		if piece.Color() == chess.Black {
+			side, row = Black, int(sq)/8
+		}
+
+		pt := piece.Type()
+		mg[side] += MG_VALUES[pt] + MG_TABLES[pt][row][file]
+		eg[side] += EG_VALUES[pt] + EG_TABLES[pt][row][file]
+		phase += PHASE_WEIGHTS[pt]
+		if pt == chess.Pawn {
+			pawnKey ^= util.ZobristPiece(piece, sq)
+		}
+
+		occupied |= SquareBB(Square(sq))
+		pieces[side][FromChessPiece(piece).Type()] |= SquareBB(Square(sq))
+	}
+
+	pawns := [2]Bitboard{pieces[White][Pawn], pieces[Black][Pawn]}
+	pawnMG, pawnEG := evaluatePawns(pawnKey, pawns, occupied)
+	mobilityMG, mobilityEG := mobility(pieces, occupied)
+	mg[White] += pawnMG + kingSafety(pieces, occupied) + mobilityMG
+	eg[White] += pawnEG + mobilityEG
+
+	return taper(mg[0]-mg[1], eg[0]-eg[1], phase)
+}
+
+// taper blends a middlegame and an endgame score by the game phase. Promotions can take
+// the phase past maxPhase, which still counts as pure middlegame.
+func taper(mg, eg, phase int) int {
+	phase = min(phase, maxPhase)
+	return (mg*phase + eg*(maxPhase-phase)) / maxPhase
+}
+
+// pawnHashMegabytes is the size of the pawn hash table, which is not configurable. Both
+// engines evaluate pawns alike, so they share the one table.
+const pawnHashMegabytes = 2
+
+var pawnHash = util.NewPawnHashTable(pawnHashMegabytes)
+
+// Pawn structure terms, each a middlegame and an endgame value. A doubled pawn is one
+// with another pawn of its side in front of it on the same file.
+var (
+	DOUBLED_PAWN  = [2]int{-10, -25}
+	ISOLATED_PAWN = [2]int{-5, -15}
+	BACKWARD_PAWN = [2]int{-8, -12}
+)
+
+// CONNECTED_PAWN, for a pawn defended by or standing beside another pawn of its side,
+// and PASSED_PAWN are indexed by rank counted from the pawn's own side.
+var CONNECTED_PAWN = [8][2]int{{0, 0}, {0, 0}, {5, 2}, {8, 4}, {14, 10}, {25, 20}, {45, 35}, {0, 0}}
+var PASSED_PAWN = [8][2]int{{0, 0}, {0, 5}, {0, 10}, {5, 15}, {15, 30}, {30, 50}, {50, 80}, {0, 0}}
+
+// evaluatePawns returns the pawn structure score for white, middlegame and endgame.
+// The part that depends on the pawns alone comes from the pawn hash table, under key,
+// when this formation has been seen before; passed pawns are then scaled by what is
+// in front of and behind them.
+func evaluatePawns(key uint64, pawns [2]Bitboard, occupied Bitboard) (int, int) {
+	entry, found := pawnHash.Lookup(key)
+	if !found {
+		entry = pawnStructure(pawns)
+		pawnHash.Store(key, entry)
+	}
+
+	mg, eg := entry.MG, entry.EG
+	for passed := Bitboard(entry.Passed); passed != 0; {
+		sq := passed.PopLSB()
+		us, sign := White, 1
+		if pawns[Black].Has(sq) {
+			us, sign = Black, -1
+		}
+		bonus := passedPawn(us, sq, pawns[us], occupied)
+		mg += sign * bonus[0]
+		eg += sign * bonus[1]
+	}
+	return mg, eg
+}
+
+// pawnStructure scores doubled, isolated, backward and connected pawns for white and
+// finds the passed pawns of both sides.
+func pawnStructure(pawns [2]Bitboard) util.PawnHashEntry {
+	var entry util.PawnHashEntry
+	for us := White; us <= Black; us++ {
+		them := us.Other()
+		own, enemy := pawns[us], pawns[them]
+		enemyAttacks := PawnAttacksBB(them, enemy)
+
+		var score [2]int
+		add := func(term [2]int) {
+			score[0] += term[0]
+			score[1] += term[1]
+		}
+
+		for b := own; b != 0; {
+			sq := b.PopLSB()
+			adjacent := AdjacentFilesBB(sq.File())
+			front := ForwardFileBB(us, sq)
+
+			if own&front != 0 {
+				add(DOUBLED_PAWN)
+			}
+
+			switch {
+			case own&adjacent == 0:
+				add(ISOLATED_PAWN)
+			case own&adjacent&^PassedPawnMask(us, sq) == 0 && enemyAttacks.Has(stopSquare(us, sq)):
+				// No pawn beside or behind it can ever defend it, and it cannot advance safely.
+				add(BACKWARD_PAWN)
+			}
+
+			phalanx := own & adjacent & RankBB(sq.Rank())
+			supported := own & PawnAttacks(them, sq)
+			if phalanx|supported != 0 {
+				add(CONNECTED_PAWN[relativeRank(us, sq)])
+			}
+
+			if enemy&PassedPawnMask(us, sq) == 0 && own&front == 0 {
+				entry.Passed |= uint64(SquareBB(sq))
+			}
+		}
+
+		if us == White {
+			entry.MG, entry.EG = entry.MG+score[0], entry.EG+score[1]
+		} else {
+			entry.MG, entry.EG = entry.MG-score[0], entry.EG-score[1]
+		}
+	}
+	return entry
+}
+
+// passedPawn returns the bonus of a passed pawn of colour us on sq. It is halved when
+// the square in front is occupied, and a quarter is added when another pawn defends it.
+func passedPawn(us Color, sq Square, own, occupied Bitboard) [2]int {
+	bonus := PASSED_PAWN[relativeRank(us, sq)]
+	supported := own&PawnAttacks(us.Other(), sq) != 0
+
+	if occupied.Has(stopSquare(us, sq)) {
+		bonus[0], bonus[1] = bonus[0]/2, bonus[1]/2
+	}
+	if supported {
+		bonus[0] += bonus[0] / 4
+		bonus[1] += bonus[1] / 4
+	}
+	return bonus
+}
+
+// King safety terms. They only count in the middlegame and fade out with the phase.
+var (
+	// PAWN_SHIELD is the bonus for the nearest pawn of the king's side in front of it on
+	// the king's file or a file beside it, by how many ranks ahead of the king it stands.
+	// PAWN_STORM is the penalty for the nearest enemy pawn there, the same way.
+	PAWN_SHIELD = [8]int{0, 15, 8, 0, 0, 0, 0, 0}
+	PAWN_STORM  = [8]int{0, -10, -30, -20, -10, 0, 0, 0}
+
+	// The penalties for a file next to the king without pawns of its side, and without
+	// any pawns at all.
+	SEMI_OPEN_KING_FILE = -10
+	OPEN_KING_FILE      = -25
+
+	// KING_ATTACK_WEIGHT is how many attack units an enemy piece adds for each square of
+	// the king zone it attacks, and SAFE_CHECK_WEIGHT how many for a piece type that can
+	// check from a square the king's side does not defend.
+	KING_ATTACK_WEIGHT = [6]int{Knight: 2, Bishop: 2, Rook: 3, Queen: 5}
+	SAFE_CHECK_WEIGHT  = [6]int{Knight: 4, Bishop: 3, Rook: 5, Queen: 6}
+
+	// ATTACKER_SCALE is the percentage of the attack units that counts, by the number of
+	// pieces attacking the king zone: a lone attacker is rarely dangerous.
+	ATTACKER_SCALE = [8]int{0, 25, 50, 75, 88, 94, 97, 99}
+)
+
+// maxKingDanger caps the penalty for attacks on the king.
+const maxKingDanger = 500
+
+// kingSafety returns the middlegame king safety score for white.
+func kingSafety(pieces [2][6]Bitboard, occupied Bitboard) int {
+	return sideKingSafety(White, pieces, occupied) - sideKingSafety(Black, pieces, occupied)
+}
+
+// sideKingSafety scores the shelter of the king of colour us and the attacks on it.
+func sideKingSafety(us Color, pieces [2][6]Bitboard, occupied Bitboard) int {
+	them := us.Other()
+	if pieces[us][King] == 0 {
+		return 0
+	}
+	king := pieces[us][King].LSB()
+	ownPawns, enemyPawns := pieces[us][Pawn], pieces[them][Pawn]
+	score := 0
+
+	// Shelter and storm on the king's file and the files beside it, moved in from the edge.
+	center := min(max(king.File(), 1), 6)
+	for file := center - 1; file <= center+1; file++ {
+		fileBB := FileBB(file)
+		ahead := fileBB & ForwardRanksBB(us, king.Rank())
+
+		if shield := ownPawns & ahead; shield != 0 {
+			score += PAWN_SHIELD[relativeRank(us, nearestPawn(us, shield))-relativeRank(us, king)]
+		}
+		if storm := enemyPawns & ahead; storm != 0 {
+			score += PAWN_STORM[relativeRank(us, nearestPawn(us, storm))-relativeRank(us, king)]
+		}
+
+		switch {
+		case (ownPawns|enemyPawns)&fileBB == 0:
+			score += OPEN_KING_FILE
+		case ownPawns&fileBB == 0:
+			score += SEMI_OPEN_KING_FILE
+		}
+	}
+
+	// Attacks on the king zone and safe checks, in attack units.
+	zone := KingAttacks(king) | SquareBB(king)
+	var theirs Bitboard
+	for pt := Pawn; pt <= King; pt++ {
+		theirs |= pieces[them][pt]
+	}
+	safe := ^attackedBy(us, pieces, occupied) &^ theirs
+
+	var checks [6]Bitboard
+	checks[Knight] = KnightAttacks(king)
+	checks[Bishop] = BishopAttacks(king, occupied)
+	checks[Rook] = RookAttacks(king, occupied)
+	checks[Queen] = checks[Bishop] | checks[Rook]
+
+	attackers, units := 0, 0
+	for pt := Knight; pt <= Queen; pt++ {
+		var reach Bitboard
+		for b := pieces[them][pt]; b != 0; {
+			attacks := Attacks(pt, b.PopLSB(), occupied)
+			if hits := attacks & zone; hits != 0 {
+				attackers++
+				units += KING_ATTACK_WEIGHT[pt] * hits.Count()
+			}
+			reach |= attacks
+		}
+		if reach&checks[pt]&safe != 0 {
+			units += SAFE_CHECK_WEIGHT[pt]
+		}
+	}
+
+	return score - min(units*units*ATTACKER_SCALE[min(attackers, 7)]/200, maxKingDanger)
+}
+
+// attackedBy returns every square the pieces of colour c attack.
+func attackedBy(c Color, pieces [2][6]Bitboard, occupied Bitboard) Bitboard {
+	attacks := PawnAttacksBB(c, pieces[c][Pawn])
+	for pt := Knight; pt <= King; pt++ {
+		for b := pieces[c][pt]; b != 0; {
+			attacks |= Attacks(pt, b.PopLSB(), occupied)
+		}
+	}
+	return attacks
+}
+
+// nearestPawn returns the pawn of pawns closest to the back rank of colour c.
+func nearestPawn(c Color, pawns Bitboard) Square {
+	if c == White {
+		return pawns.LSB()
+	}
+	return pawns.MSB()
+}
+
+// relativeRank returns the rank of sq counted from the side of colour c, 0 to 7.
+func relativeRank(c Color, sq Square) int {
+	if c == White {
+		return sq.Rank()
+	}
+	return 7 - sq.Rank()
+}
+
+// stopSquare returns the square in front of a pawn of colour c on sq.
+func stopSquare(c Color, sq Square) Square {
+	if c == White {
+		return sq + 8
+	}
+	return sq - 8
+}
+
+// MOBILITY is the middlegame and endgame bonus of a knight, bishop, rook or queen, by
+// how many squares of its side's mobility area it attacks.
+var MOBILITY = [6][][2]int{
+	Knight: {{-37, -49}, {-32, -34}, {-7, -18}, {-2, -8}, {2, 5}, {8, 9}, {13, 14}, {17, 16}, {20, 20}},
+	Bishop: {
+		{-29, -35}, {-12, -14}, {10, -2}, {16, 8}, {23, 14}, {31, 25}, {33, 32},
+		{38, 34}, {38, 39}, {41, 44}, {49, 47}, {49, 52}, {55, 53}, {59, 58},
+	},
+	Rook: {
+		{-35, -46}, {-16, -11}, {-9, 17}, {-6, 33}, {-3, 41}, {-1, 49}, {5, 67}, {10, 71},
+		{18, 79}, {17, 85}, {19, 93}, {23, 99}, {28, 100}, {29, 101}, {35, 103},
+	},
+	Queen: {
+		{-23, -22}, {-13, -9}, {2, 5}, {2, 11}, {8, 20}, {13, 32}, {17, 37},
+		{25, 44}, {26, 47}, {29, 55}, {34, 56}, {36, 62}, {36, 68}, {40, 72},
+		{40, 74}, {42, 76}, {43, 80}, {44, 82}, {47, 84}, {53, 86}, {53, 89},
+		{59, 100}, {61, 102}, {61, 105}, {64, 110}, {65, 115}, {68, 124}, {70, 127},
+	},
+}
+
+// mobility returns the mobility score for white, middlegame and endgame. A side's
+// mobility area is every square but those of its own pawns and king and those the
+// enemy pawns attack, where a piece would only be chased away.
+func mobility(pieces [2][6]Bitboard, occupied Bitboard) (int, int) {
+	var mg, eg [2]int
+	for us := White; us <= Black; us++ {
+		them := us.Other()
+		area := ^(pieces[us][Pawn] | pieces[us][King] | PawnAttacksBB(them, pieces[them][Pawn]))
+
+		for pt := Knight; pt <= Queen; pt++ {
+			for b := pieces[us][pt]; b != 0; {
+				count := (Attacks(pt, b.PopLSB(), occupied) & area).Count()
+				mg[us] += MOBILITY[pt][count][0]
+				eg[us] += MOBILITY[pt][count][1]
+			}
+		}
+	}
+	return mg[White] - mg[Black], eg[White] - eg[Black]
+}
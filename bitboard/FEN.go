@@ -0,0 +1,134 @@
+package bitboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseFEN builds a position from a FEN string. The move counters may be left out.
+func ParseFEN(fen string) (*Position, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("fen %q: expected at least 4 fields", fen)
+	}
+
+	p := &Position{epSquare: NoSquare, fullmove: 1}
+	for sq := range p.board {
+		p.board[sq] = NoPiece
+	}
+
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, fmt.Errorf("fen %q: expected 8 ranks", fen)
+	}
+	for i, row := range ranks {
+		rank, file := 7-i, 0
+		for _, c := range row {
+			switch {
+			case c >= '1' && c <= '8':
+				file += int(c - '0')
+			case strings.ContainsRune(pieceChars, c) && file < 8:
+				p.putPiece(Piece(strings.IndexRune(pieceChars, c)), NewSquare(file, rank))
+				file++
+			default:
+				return nil, fmt.Errorf("fen %q: bad rank %q", fen, row)
+			}
+		}
+		if file != 8 {
+			return nil, fmt.Errorf("fen %q: rank %q does not cover 8 files", fen, row)
+		}
+	}
+	if p.pieces[White][King].Count() != 1 || p.pieces[Black][King].Count() != 1 {
+		return nil, fmt.Errorf("fen %q: each side needs exactly one king", fen)
+	}
+
+	switch fields[1] {
+	case "w":
+		p.side = White
+	case "b":
+		p.side = Black
+		p.hash ^= sideKey
+	default:
+		return nil, fmt.Errorf("fen %q: bad side to move %q", fen, fields[1])
+	}
+
+	if fields[2] != "-" {
+		for _, c := range fields[2] {
+			i := strings.IndexRune("KQkq", c)
+			if i < 0 {
+				return nil, fmt.Errorf("fen %q: bad castling rights %q", fen, fields[2])
+			}
+			p.castling |= 1 << i
+		}
+	}
+	p.hash ^= castleKeys[p.castling]
+
+	if fields[3] != "-" {
+		sq, ok := ParseSquare(fields[3])
+		if !ok {
+			return nil, fmt.Errorf("fen %q: bad en passant square %q", fen, fields[3])
+		}
+		p.epSquare = sq
+		if p.epCapturable() {
+			p.hash ^= enPassantKeys[sq.File()]
+		}
+	}
+
+	if len(fields) >= 6 {
+		var err error
+		if p.halfmove, err = strconv.Atoi(fields[4]); err != nil {
+			return nil, fmt.Errorf("fen %q: bad halfmove clock: %w", fen, err)
+		}
+		if p.fullmove, err = strconv.Atoi(fields[5]); err != nil {
+			return nil, fmt.Errorf("fen %q: bad fullmove number: %w", fen, err)
+		}
+	}
+
+	return p, nil
+}
+
+// FEN returns the position as a FEN string.
+func (p *Position) FEN() string {
+	var sb strings.Builder
+
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := p.board[NewSquare(file, rank)]
+			if piece == NoPiece {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			sb.WriteByte(pieceChars[piece])
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+		}
+		if rank > 0 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if p.side == White {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	if p.castling == 0 {
+		sb.WriteByte('-')
+	}
+	for i, c := range "KQkq" {
+		if p.castling&(1<<i) != 0 {
+			sb.WriteRune(c)
+		}
+	}
+
+	fmt.Fprintf(&sb, " %s %d %d", p.epSquare, p.halfmove, p.fullmove)
+	return sb.String()
+}
@@ -0,0 +1,143 @@
+package bitboard
+
+// PseudoLegalMoves appends every move of the side to move to moves, including moves
+// that leave its own king in check, and returns the extended slice.
+func (p *Position) PseudoLegalMoves(moves []Move) []Move {
+	us, them := p.side, p.side.Other()
+	own, enemy := p.colors[us], p.colors[them]
+	occupied := own | enemy
+	empty := ^occupied
+
+	moves = p.pawnMoves(moves, empty, enemy)
+
+	for pt := Knight; pt <= King; pt++ {
+		for from := p.pieces[us][pt]; from != 0; {
+			sq := from.PopLSB()
+
+			var targets Bitboard
+			switch pt {
+			case Knight:
+				targets = KnightAttacks(sq)
+			case Bishop:
+				targets = BishopAttacks(sq, occupied)
+			case Rook:
+				targets = RookAttacks(sq, occupied)
+			case Queen:
+				targets = QueenAttacks(sq, occupied)
+			case King:
+				targets = KingAttacks(sq)
+			}
+
+			for targets &^= own; targets != 0; {
+				to := targets.PopLSB()
+				var flags MoveFlag
+				if enemy.Has(to) {
+					flags = FlagCapture
+				}
+				moves = append(moves, NewMove(sq, to, NoPieceType, flags))
+			}
+		}
+	}
+
+	return p.castlingMoves(moves, occupied)
+}
+
+func (p *Position) pawnMoves(moves []Move, empty, enemy Bitboard) []Move {
+	us := p.side
+	pawns := p.pieces[us][Pawn]
+
+	forward, promotionRank, doubleRank := 8, Rank8BB, Rank4BB
+	push := North
+	if us == Black {
+		forward, promotionRank, doubleRank = -8, Rank1BB, Rank5BB
+		push = South
+	}
+
+	single := push(pawns) & empty
+	double := push(single) & empty & doubleRank
+
+	for targets := single; targets != 0; {
+		to := targets.PopLSB()
+		moves = appendPawnMove(moves, to-Square(forward), to, 0, promotionRank)
+	}
+	for targets := double; targets != 0; {
+		to := targets.PopLSB()
+		moves = append(moves, NewMove(to-Square(2*forward), to, NoPieceType, FlagDoublePush))
+	}
+
+	for from := pawns; from != 0; {
+		sq := from.PopLSB()
+		for targets := PawnAttacks(us, sq) & enemy; targets != 0; {
+			moves = appendPawnMove(moves, sq, targets.PopLSB(), FlagCapture, promotionRank)
+		}
+		if p.epSquare != NoSquare && PawnAttacks(us, sq).Has(p.epSquare) {
+			moves = append(moves, NewMove(sq, p.epSquare, NoPieceType, FlagCapture|FlagEnPassant))
+		}
+	}
+
+	return moves
+}
+
+// appendPawnMove appends a pawn move, expanded into the four promotions when it
+// reaches the last rank.
+func appendPawnMove(moves []Move, from, to Square, flags MoveFlag, promotionRank Bitboard) []Move {
+	if !promotionRank.Has(to) {
+		return append(moves, NewMove(from, to, NoPieceType, flags))
+	}
+	for _, promo := range [...]PieceType{Queen, Knight, Rook, Bishop} {
+		moves = append(moves, NewMove(from, to, promo, flags))
+	}
+	return moves
+}
+
+// castlingMoves appends the castling moves whose squares between king and rook are
+// empty and whose king path is not attacked.
+func (p *Position) castlingMoves(moves []Move, occupied Bitboard) []Move {
+	us, them := p.side, p.side.Other()
+	kingSide, queenSide := WhiteKingSide, WhiteQueenSide
+	king := E1
+	if us == Black {
+		kingSide, queenSide = BlackKingSide, BlackQueenSide
+		king = E8
+	}
+	if p.castling&(kingSide|queenSide) == 0 || p.board[king] != MakePiece(us, King) || p.IsAttacked(king, them) {
+		return moves
+	}
+
+	if p.castling&kingSide != 0 && occupied&(SquareBB(king+1)|SquareBB(king+2)) == 0 &&
+		!p.IsAttacked(king+1, them) && !p.IsAttacked(king+2, them) {
+		moves = append(moves, NewMove(king, king+2, NoPieceType, FlagCastle))
+	}
+	if p.castling&queenSide != 0 && occupied&(SquareBB(king-1)|SquareBB(king-2)|SquareBB(king-3)) == 0 &&
+		!p.IsAttacked(king-1, them) && !p.IsAttacked(king-2, them) {
+		moves = append(moves, NewMove(king, king-2, NoPieceType, FlagCastle))
+	}
+	return moves
+}
+
+// LegalMoves returns every legal move of the side to move. Each pseudo-legal move is
+// made and dropped if it leaves the mover's king attacked.
+func (p *Position) LegalMoves() []Move {
+	pseudo := p.PseudoLegalMoves(make([]Move, 0, 64))
+	legal := pseudo[:0]
+
+	us := p.side
+	for _, m := range pseudo {
+		p.MakeMove(m)
+		if !p.IsAttacked(p.KingSquare(us), us.Other()) {
+			legal = append(legal, m)
+		}
+		p.UnmakeMove()
+	}
+	return legal
+}
+
+// IsCheckmate and IsStalemate report whether the side to move has no legal move, with
+// and without being in check.
+func (p *Position) IsCheckmate() bool {
+	return p.InCheck() && len(p.LegalMoves()) == 0
+}
+
+func (p *Position) IsStalemate() bool {
+	return !p.InCheck() && len(p.LegalMoves()) == 0
+}
@@ -0,0 +1,54 @@
+package bitboard
+
+// Masks for pawn structure evaluation.
+var (
+	forwardFile [2][64]Bitboard
+	passedMasks [2][64]Bitboard
+)
+
+func init() {
+	for sq := A1; sq <= H8; sq++ {
+		for b := North(SquareBB(sq)); b != 0; b = North(b) {
+			forwardFile[White][sq] |= b
+		}
+		for b := South(SquareBB(sq)); b != 0; b = South(b) {
+			forwardFile[Black][sq] |= b
+		}
+		for c := White; c <= Black; c++ {
+			span := forwardFile[c][sq]
+			passedMasks[c][sq] = span | East(span) | West(span)
+		}
+	}
+}
+
+// AdjacentFilesBB returns every square on the files either side of file.
+func AdjacentFilesBB(file int) Bitboard {
+	return East(FileBB(file)) | West(FileBB(file))
+}
+
+// ForwardFileBB returns the squares in front of sq on its file, as seen by colour c.
+func ForwardFileBB(c Color, sq Square) Bitboard {
+	return forwardFile[c][sq]
+}
+
+// ForwardRanksBB returns every square on the ranks in front of rank, as seen by colour c.
+func ForwardRanksBB(c Color, rank int) Bitboard {
+	if c == White {
+		return ^Bitboard(0) << (8 * (rank + 1))
+	}
+	return ^Bitboard(0) >> (8 * (8 - rank))
+}
+
+// PassedPawnMask returns the squares in front of sq on its own and the adjacent files.
+// A pawn of colour c on sq is passed when no enemy pawn stands on any of them.
+func PassedPawnMask(c Color, sq Square) Bitboard {
+	return passedMasks[c][sq]
+}
+
+// PawnAttacksBB returns every square attacked by the pawns of colour c.
+func PawnAttacksBB(c Color, pawns Bitboard) Bitboard {
+	if c == White {
+		return East(North(pawns)) | West(North(pawns))
+	}
+	return East(South(pawns)) | West(South(pawns))
+}
@@ -0,0 +1,40 @@
+package bitboard
+
+// PerftDivision is the perft count below one root move.
+type PerftDivision struct {
+	Move  Move
+	Nodes int
+}
+
+// Perft counts the leaf nodes of the move tree to the given depth using make and
+// unmake, so it checks both the generator and that unmake restores the position.
+func Perft(p *Position, depth int) int {
+	if depth <= 0 {
+		return 1
+	}
+
+	moves := p.LegalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+
+	nodes := 0
+	for _, m := range moves {
+		p.MakeMove(m)
+		nodes += Perft(p, depth-1)
+		p.UnmakeMove()
+	}
+	return nodes
+}
+
+// Divide returns the perft count below each legal move of the position.
+func Divide(p *Position, depth int) []PerftDivision {
+	var divisions []PerftDivision
+
+	for _, m := range p.LegalMoves() {
+		p.MakeMove(m)
+		divisions = append(divisions, PerftDivision{Move: m, Nodes: Perft(p, depth-1)})
+		p.UnmakeMove()
+	}
+	return divisions
+}
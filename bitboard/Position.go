@@ -0,0 +1,296 @@
+package bitboard
+
+import (
+	"DCAI.com/packages/util"
+	"github.com/notnil/chess"
+)
+
+// Zobrist keys taken from util, so a Position hashes to the same key as the
+// chess.Position it was converted from and both can share one transposition table.
+var (
+	pieceKeys     [12][64]uint64
+	sideKey       uint64
+	castleKeys    [16]uint64
+	enPassantKeys [8]uint64
+)
+
+// castleLost holds the rights that go when a piece moves from or to a rook's home
+// square. King moves clear both rights of their side separately.
+var castleLost [64]uint8
+
+func init() {
+	for p := Piece(0); p < NoPiece; p++ {
+		for sq := A1; sq <= H8; sq++ {
+			pieceKeys[p][sq] = util.ZobristPiece(ToChessPiece(p), chess.Square(sq))
+		}
+	}
+	sideKey = util.ZobristSide()
+	for rights := range castleKeys {
+		castleKeys[rights] = util.ZobristCastle(rights)
+	}
+	for file := range enPassantKeys {
+		enPassantKeys[file] = util.ZobristEnPassant(file)
+	}
+
+	castleLost[H1] = WhiteKingSide
+	castleLost[A1] = WhiteQueenSide
+	castleLost[H8] = BlackKingSide
+	castleLost[A8] = BlackQueenSide
+}
+
+// Position is a mutable board. Moves are played with MakeMove and taken back with
+// UnmakeMove, which restores everything from a history kept inside the position.
+type Position struct {
+	board    [64]Piece
+	pieces   [2][6]Bitboard
+	colors   [2]Bitboard
+	side     Color
+	castling uint8
+	epSquare Square // set after every double push, like notnil/chess
+	halfmove int
+	fullmove int
+	hash     uint64
+	history  []undo
+}
+
+// undo is what UnmakeMove cannot work out from the move itself.
+type undo struct {
+	move     Move
+	captured Piece
+	castling uint8
+	epSquare Square
+	halfmove int
+	hash     uint64
+}
+
+// StartFEN is the initial position.
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// NewPosition returns the initial position.
+func NewPosition() *Position {
+	p, _ := ParseFEN(StartFEN)
+	return p
+}
+
+func (p *Position) Piece(sq Square) Piece {
+	return p.board[sq]
+}
+
+func (p *Position) Pieces(c Color, pt PieceType) Bitboard {
+	return p.pieces[c][pt]
+}
+
+func (p *Position) Color(c Color) Bitboard {
+	return p.colors[c]
+}
+
+func (p *Position) Occupied() Bitboard {
+	return p.colors[White] | p.colors[Black]
+}
+
+func (p *Position) Side() Color {
+	return p.side
+}
+
+func (p *Position) CastlingRights() uint8 {
+	return p.castling
+}
+
+// EnPassant returns the square behind a pawn that has just double-pushed, or NoSquare.
+func (p *Position) EnPassant() Square {
+	return p.epSquare
+}
+
+func (p *Position) HalfMoveClock() int {
+	return p.halfmove
+}
+
+// Hash is the Zobrist key, equal to util.ZobristHash of the same position.
+func (p *Position) Hash() uint64 {
+	return p.hash
+}
+
+// Ply is the number of moves made on this position that can still be unmade.
+func (p *Position) Ply() int {
+	return len(p.history)
+}
+
+func (p *Position) KingSquare(c Color) Square {
+	return p.pieces[c][King].LSB()
+}
+
+// AttackersTo returns the pieces of both colours attacking sq, with occupied as the
+// blockers for the sliders.
+func (p *Position) AttackersTo(sq Square, occupied Bitboard) Bitboard {
+	bishops := p.pieces[White][Bishop] | p.pieces[Black][Bishop] | p.pieces[White][Queen] | p.pieces[Black][Queen]
+	rooks := p.pieces[White][Rook] | p.pieces[Black][Rook] | p.pieces[White][Queen] | p.pieces[Black][Queen]
+
+	return PawnAttacks(Black, sq)&p.pieces[White][Pawn] |
+		PawnAttacks(White, sq)&p.pieces[Black][Pawn] |
+		KnightAttacks(sq)&(p.pieces[White][Knight]|p.pieces[Black][Knight]) |
+		KingAttacks(sq)&(p.pieces[White][King]|p.pieces[Black][King]) |
+		BishopAttacks(sq, occupied)&bishops |
+		RookAttacks(sq, occupied)&rooks
+}
+
+// IsAttacked reports whether any piece of colour by attacks sq.
+func (p *Position) IsAttacked(sq Square, by Color) bool {
+	occupied := p.Occupied()
+	return PawnAttacks(by.Other(), sq)&p.pieces[by][Pawn] != 0 ||
+		KnightAttacks(sq)&p.pieces[by][Knight] != 0 ||
+		KingAttacks(sq)&p.pieces[by][King] != 0 ||
+		BishopAttacks(sq, occupied)&(p.pieces[by][Bishop]|p.pieces[by][Queen]) != 0 ||
+		RookAttacks(sq, occupied)&(p.pieces[by][Rook]|p.pieces[by][Queen]) != 0
+}
+
+// InCheck reports whether the side to move is in check.
+func (p *Position) InCheck() bool {
+	return p.IsAttacked(p.KingSquare(p.side), p.side.Other())
+}
+
+// MakeMove plays m, which must be at least pseudo-legal in the position.
+func (p *Position) MakeMove(m Move) {
+	u := undo{move: m, captured: NoPiece, castling: p.castling, epSquare: p.epSquare, halfmove: p.halfmove, hash: p.hash}
+	us, them := p.side, p.side.Other()
+	from, to := m.From(), m.To()
+	moving := p.board[from]
+
+	if p.epSquare != NoSquare && p.epCapturable() {
+		p.hash ^= enPassantKeys[p.epSquare.File()]
+	}
+	p.epSquare = NoSquare
+	p.halfmove++
+
+	if m.IsEnPassant() {
+		captured := to - 8
+		if us == Black {
+			captured = to + 8
+		}
+		u.captured = p.board[captured]
+		p.removePiece(captured)
+	} else if p.board[to] != NoPiece {
+		u.captured = p.board[to]
+		p.removePiece(to)
+	}
+	if u.captured != NoPiece || moving.Type() == Pawn {
+		p.halfmove = 0
+	}
+
+	p.movePiece(from, to)
+	if m.IsPromotion() {
+		p.removePiece(to)
+		p.putPiece(MakePiece(us, m.Promo()), to)
+	}
+	if m.IsCastle() {
+		rookFrom, rookTo := castleRookSquares(to)
+		p.movePiece(rookFrom, rookTo)
+	}
+
+	p.hash ^= castleKeys[p.castling]
+	p.castling &^= castleLost[from] | castleLost[to]
+	if moving.Type() == King {
+		p.castling &^= (WhiteKingSide | WhiteQueenSide) << (2 * us)
+	}
+	p.hash ^= castleKeys[p.castling]
+
+	if m.Flags()&FlagDoublePush != 0 {
+		p.epSquare = (from + to) / 2
+		if p.epCapturableBy(them) {
+			p.hash ^= enPassantKeys[p.epSquare.File()]
+		}
+	}
+
+	if us == Black {
+		p.fullmove++
+	}
+	p.side = them
+	p.hash ^= sideKey
+	p.history = append(p.history, u)
+}
+
+// UnmakeMove takes back the last move made.
+func (p *Position) UnmakeMove() {
+	u := p.history[len(p.history)-1]
+	p.history = p.history[:len(p.history)-1]
+
+	m := u.move
+	from, to := m.From(), m.To()
+	p.side = p.side.Other()
+	us := p.side
+
+	if m.IsPromotion() {
+		p.removePiece(to)
+		p.putPiece(MakePiece(us, Pawn), to)
+	}
+	p.movePiece(to, from)
+	if m.IsCastle() {
+		rookFrom, rookTo := castleRookSquares(to)
+		p.movePiece(rookTo, rookFrom)
+	}
+	if u.captured != NoPiece {
+		captured := to
+		if m.IsEnPassant() {
+			captured = to - 8
+			if us == Black {
+				captured = to + 8
+			}
+		}
+		p.putPiece(u.captured, captured)
+	}
+
+	if us == Black {
+		p.fullmove--
+	}
+	p.castling = u.castling
+	p.epSquare = u.epSquare
+	p.halfmove = u.halfmove
+	p.hash = u.hash
+}
+
+// epCapturable reports whether the side to move can take on the en passant square.
+func (p *Position) epCapturable() bool {
+	return p.epCapturableBy(p.side)
+}
+
+// epCapturableBy reports whether c has a pawn attacking the en passant square. The
+// square only goes into the hash when this holds, matching util.ZobristHash.
+func (p *Position) epCapturableBy(c Color) bool {
+	return PawnAttacks(c.Other(), p.epSquare)&p.pieces[c][Pawn] != 0
+}
+
+func (p *Position) putPiece(piece Piece, sq Square) {
+	b := SquareBB(sq)
+	p.board[sq] = piece
+	p.pieces[piece.Color()][piece.Type()] |= b
+	p.colors[piece.Color()] |= b
+	p.hash ^= pieceKeys[piece][sq]
+}
+
+func (p *Position) removePiece(sq Square) {
+	piece := p.board[sq]
+	b := SquareBB(sq)
+	p.board[sq] = NoPiece
+	p.pieces[piece.Color()][piece.Type()] &^= b
+	p.colors[piece.Color()] &^= b
+	p.hash ^= pieceKeys[piece][sq]
+}
+
+func (p *Position) movePiece(from, to Square) {
+	piece := p.board[from]
+	p.removePiece(from)
+	p.putPiece(piece, to)
+}
+
+// castleRookSquares returns where the rook comes from and goes to for a king landing on kingTo.
+func castleRookSquares(kingTo Square) (Square, Square) {
+	switch kingTo {
+	case G1:
+		return H1, F1
+	case C1:
+		return A1, D1
+	case G8:
+		return H8, F8
+	default:
+		return A8, D8
+	}
+}
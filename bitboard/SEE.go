@@ -0,0 +1,75 @@
+package bitboard
+
+// SEEValues are the piece values used by SEE, indexed by PieceType. The king is worth
+// more than everything else together so that it is only ever the last to capture.
+var SEEValues = [6]int{100, 320, 330, 500, 900, 20000}
+
+// SEE returns the static exchange evaluation of m: the material the side to move comes
+// out with when both sides keep recapturing on m's destination with their least valuable
+// piece, each free to stop when going on would lose more. Pieces behind the capturers on
+// the same line (x-rays) join in as the ones in front leave. Pins are ignored.
+func (p *Position) SEE(m Move) int {
+	if m.IsCastle() {
+		return 0
+	}
+	from, to := m.From(), m.To()
+	side := p.board[from].Color()
+	occupied := p.Occupied()
+
+	var gain [32]int
+	switch {
+	case m.IsEnPassant():
+		gain[0] = SEEValues[Pawn]
+		occupied &^= SquareBB(NewSquare(to.File(), from.Rank()))
+	case p.board[to] != NoPiece:
+		gain[0] = SEEValues[p.board[to].Type()]
+	}
+
+	attacker := p.board[from].Type()
+	if m.IsPromotion() {
+		gain[0] += SEEValues[m.Promo()] - SEEValues[Pawn]
+		attacker = m.Promo()
+	}
+
+	bishops := p.pieces[White][Bishop] | p.pieces[Black][Bishop] | p.pieces[White][Queen] | p.pieces[Black][Queen]
+	rooks := p.pieces[White][Rook] | p.pieces[Black][Rook] | p.pieces[White][Queen] | p.pieces[Black][Queen]
+	attackers := p.AttackersTo(to, occupied)
+	fromBB := SquareBB(from)
+
+	d := 0
+	for {
+		// gain[d] is what the other side is up if it takes the piece that just captured.
+		d++
+		gain[d] = SEEValues[attacker] - gain[d-1]
+
+		occupied &^= fromBB
+		if attacker == Pawn || attacker == Bishop || attacker == Queen {
+			attackers |= BishopAttacks(to, occupied) & bishops
+		}
+		if attacker == Rook || attacker == Queen {
+			attackers |= RookAttacks(to, occupied) & rooks
+		}
+		attackers &= occupied
+
+		side = side.Other()
+		fromBB = 0
+		for pt := Pawn; pt <= King; pt++ {
+			if b := attackers & p.pieces[side][pt]; b != 0 {
+				fromBB = SquareBB(b.LSB())
+				attacker = pt
+				break
+			}
+		}
+
+		// A king cannot take on a square the other side still attacks.
+		if fromBB == 0 || (attacker == King && attackers&p.colors[side.Other()] != 0) {
+			break
+		}
+	}
+
+	// Going back from the end, each side either takes or stops, whichever is better for it.
+	for d--; d > 0; d-- {
+		gain[d-1] = -max(-gain[d-1], gain[d])
+	}
+	return gain[0]
+}
@@ -0,0 +1,214 @@
+package bitboard
+
+// Square is an index into the board, A1 = 0 through H8 = 63, the same numbering
+// notnil/chess uses.
+type Square int8
+
+const NoSquare Square = -1
+
+const (
+	A1 Square = iota
+	B1
+	C1
+	D1
+	E1
+	F1
+	G1
+	H1
+	A2
+	B2
+	C2
+	D2
+	E2
+	F2
+	G2
+	H2
+	A3
+	B3
+	C3
+	D3
+	E3
+	F3
+	G3
+	H3
+	A4
+	B4
+	C4
+	D4
+	E4
+	F4
+	G4
+	H4
+	A5
+	B5
+	C5
+	D5
+	E5
+	F5
+	G5
+	H5
+	A6
+	B6
+	C6
+	D6
+	E6
+	F6
+	G6
+	H6
+	A7
+	B7
+	C7
+	D7
+	E7
+	F7
+	G7
+	H7
+	A8
+	B8
+	C8
+	D8
+	E8
+	F8
+	G8
+	H8
+)
+
+// NewSquare returns the square on the given file and rank, both counted from 0.
+func NewSquare(file, rank int) Square {
+	return Square(rank*8 + file)
+}
+
+func (sq Square) File() int {
+	return int(sq) & 7
+}
+
+func (sq Square) Rank() int {
+	return int(sq) >> 3
+}
+
+func (sq Square) String() string {
+	if sq == NoSquare {
+		return "-"
+	}
+	return string([]byte{byte('a' + sq.File()), byte('1' + sq.Rank())})
+}
+
+// ParseSquare reads a square in coordinate form such as "e4".
+func ParseSquare(s string) (Square, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return NoSquare, false
+	}
+	return NewSquare(int(s[0]-'a'), int(s[1]-'1')), true
+}
+
+type Color uint8
+
+const (
+	White Color = iota
+	Black
+)
+
+func (c Color) Other() Color {
+	return c ^ 1
+}
+
+type PieceType uint8
+
+const (
+	Pawn PieceType = iota
+	Knight
+	Bishop
+	Rook
+	Queen
+	King
+	NoPieceType
+)
+
+// Piece is a coloured piece type, white pieces first.
+type Piece uint8
+
+const NoPiece Piece = 12
+
+func MakePiece(c Color, pt PieceType) Piece {
+	return Piece(c)*6 + Piece(pt)
+}
+
+func (p Piece) Color() Color {
+	return Color(p / 6)
+}
+
+func (p Piece) Type() PieceType {
+	if p == NoPiece {
+		return NoPieceType
+	}
+	return PieceType(p % 6)
+}
+
+const pieceChars = "PNBRQKpnbrqk"
+
+// Castling rights as bits, in the same order util.ZobristCastle expects.
+const (
+	WhiteKingSide uint8 = 1 << iota
+	WhiteQueenSide
+	BlackKingSide
+	BlackQueenSide
+)
+
+// MoveFlag records what kind of move a Move is beyond its squares.
+type MoveFlag uint8
+
+const (
+	FlagCapture MoveFlag = 1 << iota
+	FlagEnPassant
+	FlagCastle
+	FlagDoublePush
+)
+
+// Move packs from (bits 0-5), to (6-11), promotion piece type (12-14, NoPieceType
+// when there is none) and MoveFlag (15-18). The zero Move is never legal.
+type Move uint32
+
+func NewMove(from, to Square, promo PieceType, flags MoveFlag) Move {
+	return Move(from) | Move(to)<<6 | Move(promo)<<12 | Move(flags)<<15
+}
+
+func (m Move) From() Square {
+	return Square(m & 63)
+}
+
+func (m Move) To() Square {
+	return Square((m >> 6) & 63)
+}
+
+func (m Move) Promo() PieceType {
+	return PieceType((m >> 12) & 7)
+}
+
+func (m Move) Flags() MoveFlag {
+	return MoveFlag(m >> 15)
+}
+
+func (m Move) IsCapture() bool {
+	return m.Flags()&FlagCapture != 0
+}
+
+func (m Move) IsEnPassant() bool {
+	return m.Flags()&FlagEnPassant != 0
+}
+
+func (m Move) IsCastle() bool {
+	return m.Flags()&FlagCastle != 0
+}
+
+func (m Move) IsPromotion() bool {
+	return m.Promo() != NoPieceType
+}
+
+// String returns the move in UCI coordinate notation, e.g. e7e8q.
+func (m Move) String() string {
+	s := m.From().String() + m.To().String()
+	if m.IsPromotion() {
+		s += string("nbrq"[m.Promo()-Knight])
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package bitboard
+
+import (
+	"testing"
+
+	"DCAI.com/packages/util"
+	"github.com/notnil/chess"
+)
+
+// TestFromChess checks the conversion against the FEN of every reference position and of
+// every position of a game with castling, a capturable en passant square and a capture.
+func TestFromChess(t *testing.T) {
+	var positions []*chess.Position
+	for _, position := range perftPositions {
+		fen, err := chess.FEN(position.fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", position.name, err)
+		}
+		positions = append(positions, chess.NewGame(fen).Position())
+	}
+
+	game := chess.NewGame()
+	for _, uci := range []string{"e2e4", "c7c5", "e4e5", "d7d5", "e5d6", "b8c6", "g1f3", "g8f6", "f1b5", "e7d6", "e1g1"} {
+		move, err := chess.UCINotation{}.Decode(game.Position(), uci)
+		if err != nil {
+			t.Fatalf("%s: %v", uci, err)
+		}
+		if err := game.Move(move); err != nil {
+			t.Fatalf("%s: %v", uci, err)
+		}
+	}
+	positions = append(positions, game.Positions()...)
+
+	for _, position := range positions {
+		p, err := FromChess(position)
+		if err != nil {
+			t.Fatalf("%s: %v", position, err)
+		}
+		if p.FEN() != position.String() {
+			t.Errorf("got %s, want %s", p.FEN(), position)
+		}
+		if got, want := p.Hash(), util.ZobristHash(position); got != want {
+			t.Errorf("%s: got hash %#x, want %#x", position, got, want)
+		}
+	}
+}
+
+// TestFromChessWithoutKing checks that positions notnil/chess accepts without a king on
+// each side are rejected rather than converted.
+func TestFromChessWithoutKing(t *testing.T) {
+	for _, fen := range []string{"8/8/8/8/8/8/8/8 w - - 0 1", "4k3/8/8/8/8/8/8/R7 w - - 0 1", "8/8/8/8/8/8/r7/4K3 b - - 0 1"} {
+		position, err := chess.FEN(fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", fen, err)
+		}
+		if _, err := FromChess(chess.NewGame(position).Position()); err == nil {
+			t.Errorf("%s: converted a position without a king on each side", fen)
+		}
+	}
+}
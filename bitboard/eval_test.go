@@ -0,0 +1,48 @@
+package bitboard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// TestEvalMirror checks that Eval scores every reference position and its colour-flipped
+// mirror as exact opposites.
+func TestEvalMirror(t *testing.T) {
+	for _, position := range perftPositions {
+		board := chessBoard(t, position.fen)
+		mirrored := chessBoard(t, mirrorFEN(position.fen))
+		if got, want := Eval(mirrored), -Eval(board); got != want {
+			t.Errorf("%s: mirror scores %d, want %d", position.name, got, want)
+		}
+	}
+}
+
+func chessBoard(t *testing.T, fen string) *chess.Board {
+	t.Helper()
+	position, err := chess.FEN(fen)
+	if err != nil {
+		t.Fatalf("%s: invalid fen: %v", fen, err)
+	}
+	return chess.NewGame(position).Position().Board()
+}
+
+// mirrorFEN flips the board of fen top to bottom and swaps the colours of the pieces.
+// Only the placement matters to Eval, so the other fields are reset.
+func mirrorFEN(fen string) string {
+	ranks := strings.Split(strings.Fields(fen)[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+	swapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return r
+	}, strings.Join(ranks, "/"))
+	return swapped + " w - - 0 1"
+}
@@ -0,0 +1,44 @@
+package bitboard
+
+import "testing"
+
+// perftPositions are the standard perft positions from the Chess Programming Wiki,
+// with the node count at each depth from 1.
+var perftPositions = []struct {
+	name  string
+	fen   string
+	nodes []int
+}{
+	{"startpos", StartFEN, []int{20, 400, 8902, 197281, 4865609}},
+	{"Kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862, 4085603}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238, 674624}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467, 422333}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379, 2103487}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890, 3894594}},
+}
+
+// TestPerft counts every reference position to its deepest depth, or to depth 3 with
+// -short, and checks that unmake has restored the position afterwards.
+func TestPerft(t *testing.T) {
+	maxDepth := 5
+	if testing.Short() {
+		maxDepth = 3
+	}
+
+	for _, position := range perftPositions {
+		p, err := ParseFEN(position.fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", position.name, err)
+		}
+
+		for depth := 1; depth <= maxDepth && depth <= len(position.nodes); depth++ {
+			fen, hash := p.FEN(), p.Hash()
+			if got, want := Perft(p, depth), position.nodes[depth-1]; got != want {
+				t.Errorf("%s depth %d: got %d nodes, want %d", position.name, depth, got, want)
+			}
+			if p.FEN() != fen || p.Hash() != hash {
+				t.Fatalf("%s depth %d: unmake left %s, want %s", position.name, depth, p.FEN(), fen)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package bitboard
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// seeCases are worked out by hand with SEEValues and cover undefended and defended
+// targets, x-rays, en passant, promotions and a king that may not recapture.
+var seeCases = []struct {
+	fen   string
+	move  string // in UCI notation
+	value int
+}{
+	{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+	{"4k3/8/3p4/4p3/8/5N2/8/4K3 w - - 0 1", "f3e5", -220},
+	{"4k3/8/3p4/4n3/3P4/8/8/4K3 w - - 0 1", "d4e5", 220},
+	{"k7/8/3p4/4n3/8/3N4/8/K7 w - - 0 1", "d3e5", 0},
+	{"4r1k1/8/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", 100},
+	{"4r1k1/4r3/8/4p3/8/8/4R3/4R1K1 w - - 0 1", "e2e5", -400},
+	{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+	{"1r2k3/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 1300},
+	{"1rk5/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 400},
+	{"8/8/8/8/8/2k5/3pK3/3R4 w - - 0 1", "d1d2", 100},
+	{"4k3/8/8/3q4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 900},
+	{"3rk3/8/8/3q4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 900},
+}
+
+// TestSEE takes each move through notnil/chess and ConvertMove, the way the search
+// sees it, as well as straight from the legal moves of the position.
+func TestSEE(t *testing.T) {
+	for _, c := range seeCases {
+		p, err := ParseFEN(c.fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", c.fen, err)
+		}
+		fen, err := chess.FEN(c.fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", c.fen, err)
+		}
+		game := chess.NewGame(fen)
+		move, err := chess.UCINotation{}.Decode(game.Position(), c.move)
+		if err != nil {
+			t.Fatalf("%s: invalid move %s: %v", c.fen, c.move, err)
+		}
+
+		if got := p.SEE(ConvertMove(move)); got != c.value {
+			t.Errorf("%s %s: got %d, want %d", c.fen, c.move, got, c.value)
+		}
+
+		m, ok := p.FromChessMove(move)
+		if !ok {
+			t.Fatalf("%s: %s is not a legal move", c.fen, c.move)
+		}
+		if got := p.SEE(m); got != c.value {
+			t.Errorf("%s %s from the legal moves: got %d, want %d", c.fen, c.move, got, c.value)
+		}
+	}
+}
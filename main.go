@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	S "DCAI.com/packages/AI"
@@ -11,16 +16,37 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "selfplay" {
+		selfPlay()
+		return
+	}
+
+	// The first command tells us which protocol the GUI speaks.
+	input := bufio.NewReader(os.Stdin)
+	first, _ := input.ReadString('\n')
+	rest := io.MultiReader(strings.NewReader(first), input)
+
+	if strings.TrimSpace(first) == "xboard" {
+		NewCECP(rest, os.Stdout).Loop()
+		return
+	}
+	NewUCI(rest, os.Stdout).Loop()
+}
+
+// selfPlay pits the AI and AI2 engines against each other from the starting position.
+func selfPlay() {
 	originalGame := chess.NewGame()
 	movesPlayed := []string{}
 
-	InitialCap := (64 * 1048576) / 16
-	tt := S.NewTranspositionTable(InitialCap)
-	tt2 := V.NewTranspositionTable(InitialCap)
+	tt := S.NewTranspositionTable(64)
+	tt2 := V.NewTranspositionTable(64)
 
 	match := true
 	match2 := true
 
+	clock := selfPlayClock
+	clock2 := selfPlayClock
+
 	for i := 0; i < 100; i++ {
 		if originalGame.Outcome() == chess.NoOutcome {
 			if i <= 7 && match {
@@ -30,19 +56,19 @@ func main() {
 
 				if nextMove == "Still not found :(" {
 					match = false
-					score, bestMove, visitedNodes := S.IterativeDeepening(originalGame, 4, tt, movesPlayed, time.Second)
+					score, bestMove, visitedNodes, pv := searchAI(originalGame, tt, &clock)
 					moveStr := bestMove.String()
 					movesPlayed = append(movesPlayed, moveStr)
+					fmt.Println("Move Safety Negamax || Score", score, "||Best Move", bestMove, "||visitedNodes:", visitedNodes, "||PV:", util.FormatPV(originalGame.Position(), pv, chess.AlgebraicNotation{}))
 					originalGame.Move(bestMove)
-					fmt.Println("Move Safety Negamax || Score", score, "||Best Move", bestMove, "||visitedNodes:", visitedNodes)
 					fmt.Println("Move Safety Negamax Current game position:")
 				} else {
 					originalGame.MoveStr(nextMove)
 					movesPlayed = append(movesPlayed, nextMove)
 				}
 			} else {
-				score, bestMove, visitedNodes := S.IterativeDeepening(originalGame, 4, tt, movesPlayed, time.Second)
-				fmt.Println("Move Safety Negamax || Score", score, "||Best Move", bestMove, "||visitedNodes:", visitedNodes)
+				score, bestMove, visitedNodes, pv := searchAI(originalGame, tt, &clock)
+				fmt.Println("Move Safety Negamax || Score", score, "||Best Move", bestMove, "||visitedNodes:", visitedNodes, "||PV:", util.FormatPV(originalGame.Position(), pv, chess.AlgebraicNotation{}))
 				originalGame.Move(bestMove)
 				fmt.Println("Move Safety Negamax Current game position:")
 			}
@@ -56,12 +82,12 @@ func main() {
 
 				if nextMove == "Still not found :(" {
 					match2 = false
-					Vscore, VbestMove, VvisitedNodes := V.IterativeDeepening(originalGame, 4, tt2, movesPlayed, time.Second)
+					Vscore, VbestMove, VvisitedNodes, Vpv := searchAI2(originalGame, tt2, &clock2)
 					moveStr := VbestMove.String()
 					movesPlayed = append(movesPlayed, moveStr)
 
 					movesPlayed = append(movesPlayed, VbestMove.String())
-					fmt.Println("Negamax || Score", Vscore, "||Best Move", VbestMove, "||visitedNodes:", VvisitedNodes)
+					fmt.Println("Negamax || Score", Vscore, "||Best Move", VbestMove, "||visitedNodes:", VvisitedNodes, "||PV:", util.FormatPV(originalGame.Position(), Vpv, chess.AlgebraicNotation{}))
 					originalGame.Move(VbestMove)
 					fmt.Println("Negamax Current game position:")
 				} else {
@@ -69,8 +95,8 @@ func main() {
 					movesPlayed = append(movesPlayed, nextMove)
 				}
 			} else {
-				Vscore, VbestMove, VvisitedNodes := V.IterativeDeepening(originalGame, 4, tt2, movesPlayed, time.Second)
-				fmt.Println("Negamax || Score", Vscore, "||Best Move", VbestMove, "||visitedNodes:", VvisitedNodes)
+				Vscore, VbestMove, VvisitedNodes, Vpv := searchAI2(originalGame, tt2, &clock2)
+				fmt.Println("Negamax || Score", Vscore, "||Best Move", VbestMove, "||visitedNodes:", VvisitedNodes, "||PV:", util.FormatPV(originalGame.Position(), Vpv, chess.AlgebraicNotation{}))
 				originalGame.Move(VbestMove)
 				fmt.Println("Negamax Current game position:")
 			}
@@ -84,3 +110,49 @@ func main() {
 	fmt.Printf("Game completed. %s by %s.\n", originalGame.Outcome(), originalGame.Method())
 	fmt.Println(originalGame.String())
 }
+
+// selfPlayClock and selfPlayIncrement are the time control of selfPlay games.
+const (
+	selfPlayClock     = 5 * time.Minute
+	selfPlayIncrement = 2 * time.Second
+)
+
+// selfPlayThink runs one engine's search under the time manager and charges the time
+// it took to the engine's clock.
+func selfPlayThink(game *chess.Game, clock *time.Duration, search func(ctx context.Context, tm *util.TimeManager) (int, *chess.Move, int, []*chess.Move)) (int, *chess.Move, int, []*chess.Move) {
+	start := time.Now()
+	tm := util.NewTimeManager(util.TimeControl{
+		Remaining: *clock,
+		Increment: selfPlayIncrement,
+		Ply:       len(game.Moves()),
+	}, len(game.ValidMoves()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), tm.HardLimit())
+	defer cancel()
+	score, bestMove, visitedNodes, pv := search(ctx, tm)
+
+	*clock += selfPlayIncrement - time.Since(start)
+	return score, bestMove, visitedNodes, pv
+}
+
+func searchAI(game *chess.Game, tt *S.TranspositionTable, clock *time.Duration) (int, *chess.Move, int, []*chess.Move) {
+	return selfPlayThink(game, clock, func(ctx context.Context, tm *util.TimeManager) (int, *chess.Move, int, []*chess.Move) {
+		return S.IterativeDeepening(ctx, game, maxSearchDepth, 0, tt, func(info S.SearchInfo) bool {
+			if info.Bound != S.ExactScore {
+				return true
+			}
+			return tm.Continue(info.Score, info.BestMove)
+		})
+	})
+}
+
+func searchAI2(game *chess.Game, tt *V.TranspositionTable, clock *time.Duration) (int, *chess.Move, int, []*chess.Move) {
+	return selfPlayThink(game, clock, func(ctx context.Context, tm *util.TimeManager) (int, *chess.Move, int, []*chess.Move) {
+		return V.IterativeDeepening(ctx, game, maxSearchDepth, 0, tt, func(info V.SearchInfo) bool {
+			if info.Bound != V.ExactScore {
+				return true
+			}
+			return tm.Continue(info.Score, info.BestMove)
+		})
+	})
+}
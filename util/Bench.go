@@ -0,0 +1,16 @@
+package util
+
+// BenchPosition is a position searched to a fixed depth by the bench command.
+type BenchPosition struct {
+	Name string
+	FEN  string
+}
+
+// BenchPositions are kept light, as the engines only search a few thousand nodes per
+// second, but every one leaves both sides pieces so that null-move pruning applies.
+var BenchPositions = []BenchPosition{
+	{Name: "startpos", FEN: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+	{Name: "rook and pawns", FEN: "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1"},
+	{Name: "italian middlegame", FEN: "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10"},
+	{Name: "bishop against knight", FEN: "8/5pk1/6p1/3n4/8/2B2PP1/6K1/8 w - - 0 1"},
+}
@@ -0,0 +1,18 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// FormatPV writes out a principal variation starting from position, each move in the
+// given notation, e.g. chess.UCINotation{} for UCI or chess.AlgebraicNotation{} for SAN.
+func FormatPV(position *chess.Position, pv []*chess.Move, notation chess.Notation) string {
+	moves := make([]string, 0, len(pv))
+	for _, move := range pv {
+		moves = append(moves, notation.Encode(position, move))
+		position = position.Update(move)
+	}
+	return strings.Join(moves, " ")
+}
@@ -0,0 +1,68 @@
+package util
+
+import "sync/atomic"
+
+// PawnHashEntry is the evaluation of one pawn formation: its middlegame and endgame
+// score for white and the set of passed pawns, as a bitboard, for terms that also
+// depend on the other pieces.
+type PawnHashEntry struct {
+	MG, EG int
+	Passed uint64
+}
+
+// pawnSlot is stored like a transposition table slot, with the key XORed with both
+// data words so that a torn read is a miss.
+type pawnSlot struct {
+	check  atomic.Uint64
+	data   atomic.Uint64
+	passed atomic.Uint64
+}
+
+// PawnHashTable caches pawn structure evaluations by pawn key, the XOR of the
+// ZobristPiece keys of the pawns alone. Pawn formations repeat far more often than
+// positions, so even a small table hits nearly every time. Like the transposition
+// table it is lockless and shared by all search threads.
+type PawnHashTable struct {
+	slots []pawnSlot
+	mask  uint64
+}
+
+// NewPawnHashTable allocates a table of at most the given number of megabytes.
+func NewPawnHashTable(megabytes int) *PawnHashTable {
+	count := uint64(megabytes) * 1048576 / 24 // a slot is three 64-bit words
+
+	size := uint64(1)
+	for size*2 <= count {
+		size *= 2
+	}
+	return &PawnHashTable{slots: make([]pawnSlot, size), mask: size - 1}
+}
+
+// Store always replaces whatever was in the slot.
+func (pt *PawnHashTable) Store(key uint64, entry PawnHashEntry) {
+	// The top bit marks the slot as used, since a formation can score 0 with no passers.
+	data := uint64(uint16(int16(entry.MG))) | uint64(uint16(int16(entry.EG)))<<16 | 1<<63
+
+	s := &pt.slots[key&pt.mask]
+	s.check.Store(key ^ data ^ entry.Passed)
+	s.data.Store(data)
+	s.passed.Store(entry.Passed)
+}
+
+func (pt *PawnHashTable) Lookup(key uint64) (PawnHashEntry, bool) {
+	s := &pt.slots[key&pt.mask]
+	data, passed := s.data.Load(), s.passed.Load()
+	if data == 0 || s.check.Load()^data^passed != key {
+		return PawnHashEntry{}, false
+	}
+	return PawnHashEntry{MG: int(int16(data)), EG: int(int16(data >> 16)), Passed: passed}, true
+}
+
+// Clear empties the table. It must not run while a search is using the table.
+func (pt *PawnHashTable) Clear() {
+	for i := range pt.slots {
+		pt.slots[i].check.Store(0)
+		pt.slots[i].data.Store(0)
+		pt.slots[i].passed.Store(0)
+	}
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"github.com/notnil/chess"
+)
+
+// PerftDivision is the perft count below one root move.
+type PerftDivision struct {
+	Move  *chess.Move
+	Nodes int
+}
+
+// Perft counts the leaf nodes of the move tree to the given depth. It goes through
+// Game.ValidMoves, Clone and Move exactly as the search does, so a wrong count points
+// at the move generation the engine relies on.
+func Perft(game *chess.Game, depth int) int {
+	moves := game.ValidMoves()
+	if depth <= 1 {
+		if depth <= 0 {
+			return 1
+		}
+		return len(moves)
+	}
+
+	nodes := 0
+	for _, move := range moves {
+		Copy := game.Clone()
+		Copy.Move(move)
+		nodes += Perft(Copy, depth-1)
+	}
+	return nodes
+}
+
+// Divide returns the perft count below each legal move of the position.
+func Divide(game *chess.Game, depth int) []PerftDivision {
+	var divisions []PerftDivision
+
+	for _, move := range game.ValidMoves() {
+		Copy := game.Clone()
+		Copy.Move(move)
+		divisions = append(divisions, PerftDivision{Move: move, Nodes: Perft(Copy, depth-1)})
+	}
+	return divisions
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+const (
+	// moveOverhead is kept back from every limit for communication and scheduling delays.
+	moveOverhead = 30 * time.Millisecond
+
+	// singleMoveTime is all we spend when there is only one legal move.
+	singleMoveTime = 10 * time.Millisecond
+
+	// maxExtension caps how far instability can stretch the soft limit.
+	maxExtension = 3.0
+)
+
+// TimeControl is the clock situation of the side to move.
+type TimeControl struct {
+	Remaining time.Duration // time left on the clock
+	Increment time.Duration // time added after every move
+	MovesToGo int           // moves until the next time control, 0 for sudden death
+	MoveTime  time.Duration // fixed time per move, overrides the clock when set
+	Ply       int           // half-moves played so far in the game
+}
+
+// TimeManager decides how long a search may run. The hard limit is never exceeded
+// and should be used as the search deadline, while the soft limit is consulted after
+// every iteration through Continue and grows when the search looks unstable.
+type TimeManager struct {
+	start     time.Time
+	soft      time.Duration
+	hard      time.Duration
+	fixed     bool
+	extension float64
+
+	iterations int
+	lastMove   string
+	lastScore  int
+}
+
+// NewTimeManager computes the limits for a search starting now in a position with
+// the given number of legal moves.
+func NewTimeManager(tc TimeControl, legalMoves int) *TimeManager {
+	tm := &TimeManager{start: time.Now(), extension: 1}
+
+	switch {
+	case tc.MoveTime > 0:
+		tm.fixed = true
+		tm.soft = max(tc.MoveTime-moveOverhead, tc.MoveTime/2)
+		tm.hard = tm.soft
+	default:
+		remaining := max(tc.Remaining-moveOverhead, 0)
+
+		// Without a move count, assume fewer moves remain the longer the game goes.
+		movesLeft := tc.MovesToGo
+		if movesLeft <= 0 {
+			movesLeft = min(max(50-tc.Ply/2, 20), 50)
+		}
+
+		tm.soft = remaining/time.Duration(movesLeft) + tc.Increment*3/4
+		tm.hard = min(tm.soft*4, remaining/3)
+		tm.soft = min(tm.soft, tm.hard)
+	}
+
+	if legalMoves == 1 {
+		tm.soft = min(tm.soft, singleMoveTime)
+		tm.hard = min(tm.hard, singleMoveTime)
+	}
+	tm.soft = max(tm.soft, time.Millisecond)
+	tm.hard = max(tm.hard, time.Millisecond)
+
+	return tm
+}
+
+// HardLimit is the longest the search may run.
+func (tm *TimeManager) HardLimit() time.Duration {
+	return tm.hard
+}
+
+// SoftLimit is the current target time, including any extension.
+func (tm *TimeManager) SoftLimit() time.Duration {
+	if tm.fixed {
+		return tm.soft
+	}
+	return min(time.Duration(float64(tm.soft)*tm.extension), tm.hard)
+}
+
+// Continue is called after each completed iteration with its score and best move and
+// reports whether another iteration should be started. A best move that keeps changing
+// or a falling score buys more time, a stable search gives some back.
+func (tm *TimeManager) Continue(score int, bestMove *chess.Move) bool {
+	move := ""
+	if bestMove != nil {
+		move = bestMove.String()
+	}
+
+	tm.iterations++
+	if tm.iterations > 1 && !tm.fixed {
+		if move != tm.lastMove {
+			tm.extension *= 1.5
+		} else {
+			tm.extension *= 0.9
+		}
+		if drop := tm.lastScore - score; drop >= 100 {
+			tm.extension *= 1.5
+		} else if drop >= 30 {
+			tm.extension *= 1.2
+		}
+		tm.extension = min(max(tm.extension, 0.5), maxExtension)
+	}
+	tm.lastMove = move
+	tm.lastScore = score
+
+	// A fixed move time is used up to the hard limit.
+	if tm.fixed {
+		return true
+	}
+
+	// The next iteration usually costs at least as much as all the previous ones
+	// together, so only start it while less than half of the target has been used.
+	return time.Since(tm.start) < tm.SoftLimit()/2
+}
@@ -0,0 +1,210 @@
+package util
+
+import (
+	"sync/atomic"
+
+	"github.com/notnil/chess"
+)
+
+const (
+	ExactScore int = iota
+	LowerBound
+	UpperBound
+)
+
+// hashfullSample is how many entries Hashfull looks at, as the UCI spec suggests.
+const hashfullSample = 1000
+
+// PackedMove stores a move in 16 bits: from square, to square and promotion piece type.
+// The zero value means no move.
+type PackedMove uint16
+
+// EncodeMove packs a move for the transposition table. A nil move packs to zero.
+func EncodeMove(move *chess.Move) PackedMove {
+	if move == nil {
+		return 0
+	}
+	return PackedMove(move.S1()) | PackedMove(move.S2())<<6 | PackedMove(move.Promo())<<12
+}
+
+func (m PackedMove) S1() chess.Square {
+	return chess.Square(m & 63)
+}
+
+func (m PackedMove) S2() chess.Square {
+	return chess.Square((m >> 6) & 63)
+}
+
+func (m PackedMove) Promo() chess.PieceType {
+	return chess.PieceType((m >> 12) & 7)
+}
+
+// Decode finds the legal move of the position that m was packed from, or returns nil
+// if there is none (which can happen after a key collision).
+func (m PackedMove) Decode(position *chess.Position) *chess.Move {
+	if m == 0 {
+		return nil
+	}
+	for _, move := range position.ValidMoves() {
+		if move.S1() == m.S1() && move.S2() == m.S2() && move.Promo() == m.Promo() {
+			return move
+		}
+	}
+	return nil
+}
+
+// TranspositionTableEntry represents an entry in the transposition table.
+type TranspositionTableEntry struct {
+	HashKey   uint64
+	Depth     int
+	Score     int
+	ScoreType int
+	BestMove  PackedMove
+
+	generation uint8 // search that stored the entry, never 0 once stored
+}
+
+// An entry is packed into one data word laid out as
+//
+//	bits  0-15 move, 16-31 score, 32-39 depth, 40-41 score type, 42-49 generation
+//
+// and stored next to key^data. A reader that sees the two words of different writes
+// gets a key that doesn't verify and treats the slot as a miss, so no lock is needed.
+func packEntry(entry TranspositionTableEntry) uint64 {
+	score := max(min(entry.Score, 32767), -32768)
+	depth := max(min(entry.Depth, 127), -128)
+
+	return uint64(entry.BestMove) |
+		uint64(uint16(int16(score)))<<16 |
+		uint64(uint8(int8(depth)))<<32 |
+		uint64(entry.ScoreType&3)<<40 |
+		uint64(entry.generation)<<42
+}
+
+func unpackEntry(key, data uint64) TranspositionTableEntry {
+	return TranspositionTableEntry{
+		HashKey:    key,
+		BestMove:   PackedMove(data),
+		Score:      int(int16(data >> 16)),
+		Depth:      int(int8(data >> 32)),
+		ScoreType:  int((data >> 40) & 3),
+		generation: uint8(data >> 42),
+	}
+}
+
+// slot is one lockless entry: the key XORed with the data, and the data.
+type slot struct {
+	check atomic.Uint64
+	data  atomic.Uint64
+}
+
+func (s *slot) load() (uint64, uint64) {
+	data := s.data.Load()
+	return s.check.Load() ^ data, data
+}
+
+func (s *slot) store(key, data uint64) {
+	s.check.Store(key ^ data)
+	s.data.Store(data)
+}
+
+// cluster is one bucket of the table. The first slot keeps the deepest entry of the
+// current search and the second is always overwritten.
+type cluster [2]slot
+
+// TranspositionTable is a fixed-size, lockless hash table of clusters that any number
+// of goroutines may probe and store into at once. Its size is a power of two so that
+// the low bits of the Zobrist key select the cluster.
+type TranspositionTable struct {
+	clusters   []cluster
+	mask       uint64
+	generation atomic.Uint32
+}
+
+// NewTranspositionTable allocates a table of at most the given number of megabytes.
+func NewTranspositionTable(megabytes int) *TranspositionTable {
+	count := uint64(megabytes) * 1048576 / 32 // a cluster is four 64-bit words
+
+	size := uint64(1)
+	for size*2 <= count {
+		size *= 2
+	}
+
+	tt := &TranspositionTable{
+		clusters: make([]cluster, size),
+		mask:     size - 1,
+	}
+	tt.generation.Store(1)
+	return tt
+}
+
+// NewSearch ages the table so that entries from earlier searches are replaced first.
+func (tt *TranspositionTable) NewSearch() {
+	next := uint8(tt.generation.Load()) + 1
+	if next == 0 {
+		next = 1
+	}
+	tt.generation.Store(uint32(next))
+}
+
+// Store stores an entry in the transposition table.
+func (tt *TranspositionTable) Store(key uint64, entry TranspositionTableEntry) {
+	c := &tt.clusters[key&tt.mask]
+	generation := uint8(tt.generation.Load())
+	entry.generation = generation
+	data := packEntry(entry)
+
+	// Depth-preferred slot: take it when it is empty, stale or not deeper than us.
+	firstKey, firstData := c[0].load()
+	first := unpackEntry(firstKey, firstData)
+	if first.generation != generation || first.Depth <= entry.Depth {
+		if firstKey != key && firstData != 0 {
+			c[1].store(firstKey, firstData)
+		}
+		c[0].store(key, data)
+		return
+	}
+	c[1].store(key, data)
+}
+
+// Lookup looks up an entry in the transposition table.
+func (tt *TranspositionTable) Lookup(key uint64) (TranspositionTableEntry, bool) {
+	c := &tt.clusters[key&tt.mask]
+
+	for i := range c {
+		if slotKey, data := c[i].load(); data != 0 && slotKey == key {
+			return unpackEntry(key, data), true
+		}
+	}
+	return TranspositionTableEntry{}, false
+}
+
+// Clear empties the table. It must not run while a search is using the table.
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.clusters {
+		for j := range tt.clusters[i] {
+			tt.clusters[i][j].store(0, 0)
+		}
+	}
+	tt.generation.Store(1)
+}
+
+// Hashfull reports, in permille, how much of the table is used by the current search.
+func (tt *TranspositionTable) Hashfull() int {
+	generation := uint8(tt.generation.Load())
+	used, sampled := 0, 0
+
+	for index := 0; index < len(tt.clusters) && sampled < hashfullSample; index++ {
+		for i := range tt.clusters[index] {
+			if _, data := tt.clusters[index][i].load(); data != 0 && unpackEntry(0, data).generation == generation {
+				used++
+			}
+			sampled++
+		}
+	}
+
+	if sampled == 0 {
+		return 0
+	}
+	return used * 1000 / sampled
+}
@@ -0,0 +1,219 @@
+package util
+
+import (
+	"math/rand"
+
+	"github.com/notnil/chess"
+)
+
+// zobristSeed is fixed so that keys, and therefore hashes, are the same on every run.
+const zobristSeed = 0x5DCA1
+
+// Castling rights as bits, used to index zobristCastle.
+const (
+	castleWhiteKing = 1 << iota
+	castleWhiteQueen
+	castleBlackKing
+	castleBlackQueen
+)
+
+var (
+	zobristPieces    [13][64]uint64 // indexed by chess.Piece, NoPiece is left empty
+	zobristSide      uint64         // XORed in when black is to move
+	zobristCastle    [4]uint64      // one key per castling right
+	zobristEnPassant [8]uint64      // one key per en passant file
+)
+
+func init() {
+	rng := rand.New(rand.NewSource(zobristSeed))
+
+	for piece := chess.WhiteKing; piece <= chess.BlackPawn; piece++ {
+		for sq := chess.A1; sq <= chess.H8; sq++ {
+			zobristPieces[piece][sq] = rng.Uint64()
+		}
+	}
+	zobristSide = rng.Uint64()
+	for i := range zobristCastle {
+		zobristCastle[i] = rng.Uint64()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = rng.Uint64()
+	}
+}
+
+// ZobristPiece, ZobristSide, ZobristCastle and ZobristEnPassant expose the keys so
+// that other board representations hash a position exactly like ZobristHash does.
+func ZobristPiece(piece chess.Piece, sq chess.Square) uint64 {
+	return zobristPieces[piece][sq]
+}
+
+func ZobristSide() uint64 {
+	return zobristSide
+}
+
+// ZobristCastle takes the rights as bits: 1 white king side, 2 white queen side,
+// 4 black king side, 8 black queen side.
+func ZobristCastle(rights int) uint64 {
+	return castleKey(rights)
+}
+
+func ZobristEnPassant(file int) uint64 {
+	return zobristEnPassant[file]
+}
+
+// ZobristHash computes the 64-bit Zobrist key of a position from scratch, covering
+// every piece, the side to move, the castling rights and a capturable en passant square.
+func ZobristHash(position *chess.Position) uint64 {
+	var hashKey uint64
+	board := position.Board()
+
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		if piece := board.Piece(sq); piece != chess.NoPiece {
+			hashKey ^= zobristPieces[piece][sq]
+		}
+	}
+
+	if position.Turn() == chess.Black {
+		hashKey ^= zobristSide
+	}
+
+	hashKey ^= castleKey(castleMask(position.CastleRights()))
+
+	if ep := position.EnPassantSquare(); ep != chess.NoSquare && canCaptureEnPassant(board, ep, position.Turn()) {
+		hashKey ^= zobristEnPassant[ep.File()]
+	}
+
+	return hashKey
+}
+
+// ZobristUpdate returns the key of the position reached by playing move in position,
+// given key, the key of position itself. Only the squares the move touches are rehashed.
+func ZobristUpdate(key uint64, position *chess.Position, move *chess.Move) uint64 {
+	board := position.Board()
+	turn := position.Turn()
+	from, to := move.S1(), move.S2()
+	moving := board.Piece(from)
+
+	// The old en passant key goes, whatever the move.
+	if ep := position.EnPassantSquare(); ep != chess.NoSquare && canCaptureEnPassant(board, ep, turn) {
+		key ^= zobristEnPassant[ep.File()]
+	}
+
+	// Take off the captured piece, which sits behind the target square for en passant.
+	if move.HasTag(chess.EnPassant) {
+		captureSq := to - 8
+		if turn == chess.Black {
+			captureSq = to + 8
+		}
+		key ^= zobristPieces[board.Piece(captureSq)][captureSq]
+	} else if captured := board.Piece(to); captured != chess.NoPiece {
+		key ^= zobristPieces[captured][to]
+	}
+
+	// Move the piece, swapping in the promoted piece if there is one.
+	placed := moving
+	if move.Promo() != chess.NoPieceType {
+		placed = chess.NewPiece(move.Promo(), turn)
+	}
+	key ^= zobristPieces[moving][from] ^ zobristPieces[placed][to]
+
+	// Castling also moves the rook.
+	if move.HasTag(chess.KingSideCastle) || move.HasTag(chess.QueenSideCastle) {
+		rookFrom, rookTo := castleRookSquares(to)
+		rook := chess.NewPiece(chess.Rook, turn)
+		key ^= zobristPieces[rook][rookFrom] ^ zobristPieces[rook][rookTo]
+	}
+
+	// Castling rights lost by moving the king or a rook, or by a rook being captured.
+	oldRights := castleMask(position.CastleRights())
+	newRights := oldRights &^ castleRightsLost(moving, from, to)
+	key ^= castleKey(oldRights) ^ castleKey(newRights)
+
+	// A double pawn push creates an en passant square if an enemy pawn can use it.
+	if moving.Type() == chess.Pawn && (to-from == 16 || from-to == 16) {
+		ep := (from + to) / 2
+		if canCaptureEnPassantAfterPush(board, to, turn.Other()) {
+			key ^= zobristEnPassant[ep.File()]
+		}
+	}
+
+	return key ^ zobristSide
+}
+
+func castleMask(rights chess.CastleRights) int {
+	mask := 0
+	if rights.CanCastle(chess.White, chess.KingSide) {
+		mask |= castleWhiteKing
+	}
+	if rights.CanCastle(chess.White, chess.QueenSide) {
+		mask |= castleWhiteQueen
+	}
+	if rights.CanCastle(chess.Black, chess.KingSide) {
+		mask |= castleBlackKing
+	}
+	if rights.CanCastle(chess.Black, chess.QueenSide) {
+		mask |= castleBlackQueen
+	}
+	return mask
+}
+
+func castleKey(mask int) uint64 {
+	var key uint64
+	for i := range zobristCastle {
+		if mask&(1<<i) != 0 {
+			key ^= zobristCastle[i]
+		}
+	}
+	return key
+}
+
+// castleRightsLost mirrors how chess.Position updates its castling rights.
+func castleRightsLost(moving chess.Piece, from, to chess.Square) int {
+	lost := 0
+	if moving == chess.WhiteKing || from == chess.H1 || to == chess.H1 {
+		lost |= castleWhiteKing
+	}
+	if moving == chess.WhiteKing || from == chess.A1 || to == chess.A1 {
+		lost |= castleWhiteQueen
+	}
+	if moving == chess.BlackKing || from == chess.H8 || to == chess.H8 {
+		lost |= castleBlackKing
+	}
+	if moving == chess.BlackKing || from == chess.A8 || to == chess.A8 {
+		lost |= castleBlackQueen
+	}
+	return lost
+}
+
+// castleRookSquares returns where the rook comes from and goes to for a king landing on kingTo.
+func castleRookSquares(kingTo chess.Square) (chess.Square, chess.Square) {
+	switch kingTo {
+	case chess.G1:
+		return chess.H1, chess.F1
+	case chess.C1:
+		return chess.A1, chess.D1
+	case chess.G8:
+		return chess.H8, chess.F8
+	default:
+		return chess.A8, chess.D8
+	}
+}
+
+// canCaptureEnPassant reports whether a pawn of the side to move attacks the en passant square.
+func canCaptureEnPassant(board *chess.Board, ep chess.Square, turn chess.Color) bool {
+	pushed := ep + 8
+	if turn == chess.White {
+		pushed = ep - 8
+	}
+	return canCaptureEnPassantAfterPush(board, pushed, turn)
+}
+
+// canCaptureEnPassantAfterPush reports whether capturer has a pawn beside the pawn that
+// just double-pushed to pushed.
+func canCaptureEnPassantAfterPush(board *chess.Board, pushed chess.Square, capturer chess.Color) bool {
+	pawn := chess.NewPiece(chess.Pawn, capturer)
+	if pushed.File() > chess.FileA && board.Piece(pushed-1) == pawn {
+		return true
+	}
+	return pushed.File() < chess.FileH && board.Piece(pushed+1) == pawn
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// perftPositions are the standard perft positions from the Chess Programming Wiki,
+// with the node count at each depth from 1.
+var perftPositions = []struct {
+	name  string
+	fen   string
+	nodes []int
+}{
+	{"startpos", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []int{20, 400, 8902, 197281, 4865609}},
+	{"Kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862, 4085603}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238, 674624}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467, 422333}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379, 2103487}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890, 3894594}},
+}
+
+// perftNodeLimit keeps notnil/chess, which clones the game for every move, to the
+// depths it can count in a few seconds; -short keeps it to the shallow ones.
+func perftNodeLimit() int {
+	if testing.Short() {
+		return 10000
+	}
+	return 200000
+}
+
+func TestPerft(t *testing.T) {
+	for _, position := range perftPositions {
+		fen, err := chess.FEN(position.fen)
+		if err != nil {
+			t.Fatalf("%s: invalid fen: %v", position.name, err)
+		}
+		game := chess.NewGame(fen)
+
+		for depth, want := range position.nodes {
+			if want > perftNodeLimit() {
+				break
+			}
+			if got := Perft(game, depth+1); got != want {
+				t.Errorf("%s depth %d: got %d nodes, want %d", position.name, depth+1, got, want)
+			}
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	game := chess.NewGame()
+	total := 0
+	for _, division := range Divide(game, 3) {
+		total += division.Nodes
+	}
+	if want := perftPositions[0].nodes[2]; total != want {
+		t.Errorf("divide startpos depth 3: got %d nodes, want %d", total, want)
+	}
+}
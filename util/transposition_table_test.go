@@ -0,0 +1,80 @@
+package util
+
+import (
+	"sync"
+	"testing"
+)
+
+// entryFor derives every field of an entry from its key, so that an entry read back
+// under another key, or put together from two different writes, shows up as wrong.
+func entryFor(key uint64) TranspositionTableEntry {
+	n := key >> 40
+	return TranspositionTableEntry{
+		HashKey:   key,
+		Depth:     int(n % 100),
+		Score:     int(n%20000) - 10000,
+		ScoreType: int(n % 3),
+		BestMove:  PackedMove(n%4095 + 1),
+	}
+}
+
+// TestTranspositionTableConcurrent has several goroutines store and look up keys that
+// all fall into a handful of clusters, so that writes to the same slot keep racing.
+// Run it with -race: the table must need no lock, and must never return a torn entry.
+func TestTranspositionTableConcurrent(t *testing.T) {
+	const (
+		goroutines = 8
+		rounds     = 20000
+		keys       = 64
+		clusters   = 4
+	)
+	tt := NewTranspositionTable(1)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				n := uint64((g*7919 + i) % keys)
+				key := (n+1)<<40 | n%clusters
+				if i%2 == 0 {
+					tt.Store(key, entryFor(key))
+					continue
+				}
+
+				entry, found := tt.Lookup(key)
+				if !found {
+					continue
+				}
+				want := entryFor(key)
+				entry.generation = 0
+				if entry != want {
+					t.Errorf("lookup of %#x returned %+v, want %+v", key, entry, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestTranspositionTableTornSlot checks that a slot whose two words come from
+// different writes is a miss rather than a wrong entry.
+func TestTranspositionTableTornSlot(t *testing.T) {
+	tt := NewTranspositionTable(1)
+	key := uint64(1)<<40 | 5
+	other := uint64(2)<<40 | 5
+
+	tt.Store(key, entryFor(key))
+	if _, found := tt.Lookup(key); !found {
+		t.Fatalf("lookup of %#x: not found after store", key)
+	}
+
+	// The check word of the first write next to the data word of another one.
+	s := &tt.clusters[key&tt.mask][0]
+	s.data.Store(packEntry(entryFor(other)))
+	if entry, found := tt.Lookup(key); found {
+		t.Errorf("lookup of a torn slot returned %+v", entry)
+	}
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// TestZobrist plays random games from the start position, checks every incremental
+// update against a full rehash and fails on any key shared by two different positions.
+func TestZobrist(t *testing.T) {
+	games, maxPlies := 300, 200
+	if testing.Short() {
+		games = 30
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	identities := make(map[uint64]string)
+	positions, mismatches, collisions := 0, 0, 0
+
+	record := func(position *chess.Position, key uint64) {
+		positions++
+		id := positionIdentity(position)
+		if earlier, ok := identities[key]; ok && earlier != id {
+			collisions++
+			t.Errorf("%s and %s share key %#x", earlier, id, key)
+		}
+		identities[key] = id
+	}
+
+	for g := 0; g < games; g++ {
+		position := chess.StartingPosition()
+		key := ZobristHash(position)
+		record(position, key)
+
+		for ply := 0; ply < maxPlies; ply++ {
+			moves := position.ValidMoves()
+			if len(moves) == 0 {
+				break
+			}
+			move := moves[rng.Intn(len(moves))]
+
+			key = ZobristUpdate(key, position, move)
+			next := position.Update(move)
+			if want := ZobristHash(next); key != want {
+				mismatches++
+				t.Errorf("%s after %s: got key %#x, want %#x", position, move, key, want)
+				key = want
+			}
+			position = next
+			record(position, key)
+		}
+	}
+
+	t.Logf("%d positions, %d distinct keys", positions, len(identities))
+	if mismatches != 0 || collisions != 0 {
+		t.Fatalf("%d mismatches, %d collisions", mismatches, collisions)
+	}
+}
+
+// positionIdentity describes everything the key is meant to cover, so that two positions
+// with the same identity must hash alike and two with different ones should not.
+func positionIdentity(position *chess.Position) string {
+	fields := strings.Fields(position.String())
+	ep := "-"
+	if sq := position.EnPassantSquare(); sq != chess.NoSquare && canCaptureEnPassant(position.Board(), sq, position.Turn()) {
+		ep = sq.String()
+	}
+	return strings.Join([]string{fields[0], fields[1], fields[2], ep}, " ")
+}